@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ChangeKind describes how a watched file changed.
+type ChangeKind int
+
+const (
+	// ChangeCreated is reported when the file appears.
+	ChangeCreated ChangeKind = iota + 1
+	// ChangeModified is reported when the content of an existing file
+	// changes, including through a symlink swap.
+	ChangeModified
+	// ChangeRemoved is reported when the file is deleted.
+	ChangeRemoved
+	// ChangeRenamed is reported when the file is moved away.
+	ChangeRenamed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeCreated:
+		return "created"
+	case ChangeModified:
+		return "modified"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeRenamed:
+		return "renamed"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes a change of a watched file. Unlike the raw event it is
+// derived from, it always names the watched path.
+//
+// The digests are those computed by the change detector of the path, see
+// WithChangeDetector. Size and ModTime describe the file after the change,
+// following symbolic links, and are zero once it no longer exists.
+type Change struct {
+	Path      string
+	Kind      ChangeKind
+	OldDigest []byte
+	NewDigest []byte
+	Size      int64
+	ModTime   time.Time
+
+	// Event is the event which triggered the change.
+	Event fsnotify.Event
+}
+
+// newChange describes the change of path from the given digest, and stats the
+// file to find its current state. existed tells whether the file existed
+// before the change.
+func newChange(path string, event fsnotify.Event, existed bool, oldDigest, newDigest []byte) Change {
+	c := Change{
+		Path:      path,
+		OldDigest: oldDigest,
+		NewDigest: newDigest,
+		Event:     event,
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err != nil && event.Op&fsnotify.Rename != 0:
+		c.Kind = ChangeRenamed
+	case err != nil:
+		c.Kind = ChangeRemoved
+	case !existed:
+		c.Kind = ChangeCreated
+	default:
+		c.Kind = ChangeModified
+	}
+
+	if err == nil {
+		c.Size = info.Size()
+		c.ModTime = info.ModTime()
+	}
+	return c
+}
+
+// exists reports whether the change leaves the file in place.
+func (c Change) exists() bool {
+	return c.Kind == ChangeCreated || c.Kind == ChangeModified
+}
+
+// changeKindOf guesses the kind of change from a raw event, for changes which
+// aren't derived from the file itself.
+func changeKindOf(op fsnotify.Op) ChangeKind {
+	switch {
+	case op&fsnotify.Create != 0:
+		return ChangeCreated
+	case op&fsnotify.Remove != 0:
+		return ChangeRemoved
+	case op&fsnotify.Rename != 0:
+		return ChangeRenamed
+	default:
+		return ChangeModified
+	}
+}
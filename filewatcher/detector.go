@@ -0,0 +1,105 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// ChangeDetector decides whether a watched file has changed when an event
+// is received for it.
+type ChangeDetector interface {
+	// Digest returns a fingerprint of the current state of the file, or nil
+	// if the file can't be read.
+	Digest(path string) []byte
+
+	// Changed reports whether the file has changed, given the digest recorded
+	// for the previous notification and the current one.
+	Changed(prev, cur []byte) bool
+}
+
+// SHA256Detector returns a ChangeDetector that reports a change whenever the
+// SHA-256 of the file content differs. This is the default detector.
+func SHA256Detector() ChangeDetector {
+	return sha256Detector{}
+}
+
+// ModTimeSizeDetector returns a ChangeDetector that reports a change whenever
+// the modification time or the size of the file differs. It never reads the
+// file content, which makes it cheap for large files.
+func ModTimeSizeDetector() ChangeDetector {
+	return modTimeSizeDetector{}
+}
+
+// AlwaysDetector returns a ChangeDetector that reports a change for every
+// event received for the file.
+func AlwaysDetector() ChangeDetector {
+	return alwaysDetector{}
+}
+
+type sha256Detector struct{}
+
+// Digest gets the SHA-256 of the given file, or nil if there's a problem.
+func (sha256Detector) Digest(path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	h := sha256.New()
+	_, _ = io.Copy(h, r)
+	return h.Sum(nil)
+}
+
+func (sha256Detector) Changed(prev, cur []byte) bool {
+	return !bytes.Equal(prev, cur)
+}
+
+type modTimeSizeDetector struct{}
+
+// Digest encodes the modification time and size of the given file, or nil if
+// the file can't be stat'ed.
+func (modTimeSizeDetector) Digest(path string) []byte {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], uint64(fi.ModTime().UnixNano()))
+	binary.BigEndian.PutUint64(b[8:], uint64(fi.Size()))
+	return b
+}
+
+func (modTimeSizeDetector) Changed(prev, cur []byte) bool {
+	return !bytes.Equal(prev, cur)
+}
+
+type alwaysDetector struct{}
+
+func (alwaysDetector) Digest(string) []byte {
+	return nil
+}
+
+func (alwaysDetector) Changed([]byte, []byte) bool {
+	return true
+}
@@ -0,0 +1,247 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// dirWatcher delivers the events for the entries of a single directory.
+type dirWatcher interface {
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// newDirWatcher picks the backend used to watch the given directory. fsnotify
+// is used, unless polling is requested, or the directory is on a filesystem
+// which is known not to support inotify, or inotify is out of resources.
+func newDirWatcher(path string, funcs *patchTable, opts *watcherOptions) (dirWatcher, error) {
+	if opts.pollInterval > 0 {
+		return newPollingDirWatcher(path, opts.pollInterval), nil
+	}
+
+	fallback := opts.fallbackInterval > 0
+	if fallback && !funcs.supportsInotify(path) {
+		return newPollingDirWatcher(path, opts.fallbackInterval), nil
+	}
+
+	watcher, err := funcs.newWatcher()
+	if err != nil {
+		if fallback && inotifyUnavailable(err) {
+			return newPollingDirWatcher(path, opts.fallbackInterval), nil
+		}
+		return nil, err
+	}
+
+	dw, err := newFsnotifyDirWatcher(path, watcher, funcs.addWatcherPath)
+	if err != nil {
+		_ = watcher.Close()
+		if fallback && inotifyUnavailable(err) {
+			return newPollingDirWatcher(path, opts.fallbackInterval), nil
+		}
+		return nil, err
+	}
+
+	return dw, nil
+}
+
+// fsnotifyDirWatcher watches a directory with fsnotify.
+//
+// If the directory doesn't exist, its closest existing ancestor is watched
+// instead, descending as the missing directories appear. Once the directory
+// exists, a create event is synthesized for each of its entries. If the
+// directory is removed, the watch moves back up to the closest ancestor.
+type fsnotifyDirWatcher struct {
+	watcher *fsnotify.Watcher
+	addPath func(*fsnotify.Watcher, string) error
+
+	// dir is the directory to watch.
+	dir string
+
+	// watched is the directory actually watched, either dir or one of its
+	// ancestors.
+	// used only by the dirWatcher goroutine once started
+	watched string
+
+	events chan fsnotify.Event
+	errors chan error
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	doneCh    chan struct{}
+}
+
+func newFsnotifyDirWatcher(dir string, watcher *fsnotify.Watcher,
+	addPath func(*fsnotify.Watcher, string) error,
+) (*fsnotifyDirWatcher, error) {
+	w := &fsnotifyDirWatcher{
+		watcher: watcher,
+		addPath: addPath,
+		dir:     filepath.Clean(dir),
+		events:  make(chan fsnotify.Event),
+		errors:  make(chan error),
+		closeCh: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+
+	if err := w.watchClosest(); err != nil {
+		return nil, err
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *fsnotifyDirWatcher) Events() <-chan fsnotify.Event {
+	return w.events
+}
+
+func (w *fsnotifyDirWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *fsnotifyDirWatcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.closeCh)
+		err = w.watcher.Close()
+	})
+	<-w.doneCh
+	return err
+}
+
+func (w *fsnotifyDirWatcher) run() {
+	defer close(w.doneCh)
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.handleEvent(event) {
+				return
+			}
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			if !w.sendError(err) {
+				return
+			}
+
+		case <-w.closeCh:
+			return
+		}
+	}
+}
+
+// handleEvent forwards the events for the entries of dir, and moves the
+// watch when dir or one of its ancestors appears or disappears. It returns
+// false if the watcher was closed meanwhile.
+func (w *fsnotifyDirWatcher) handleEvent(event fsnotify.Event) bool {
+	name := filepath.Clean(event.Name)
+
+	if name == w.watched && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		// the watched directory is gone, move up
+		_ = w.watcher.Remove(w.watched)
+		w.watched = ""
+		return w.rewatch()
+	}
+
+	if w.watched == w.dir {
+		return w.sendEvent(event)
+	}
+
+	if isWithin(w.dir, name) {
+		// a directory on the way to dir may have appeared, move down
+		return w.rewatch()
+	}
+
+	return true
+}
+
+// rewatch watches the closest existing ancestor of dir, or dir itself, in
+// which case a create event is synthesized for each of its entries. It
+// returns false if the watcher was closed meanwhile.
+func (w *fsnotifyDirWatcher) rewatch() bool {
+	prev := w.watched
+	if err := w.watchClosest(); err != nil {
+		return w.sendError(err)
+	}
+
+	if prev == w.dir || w.watched != w.dir {
+		return true
+	}
+
+	entries, _ := os.ReadDir(w.dir)
+	for _, e := range entries {
+		if !w.sendEvent(fsnotify.Event{Name: filepath.Join(w.dir, e.Name()), Op: fsnotify.Create}) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchClosest watches dir, or its closest existing ancestor if dir doesn't
+// exist.
+func (w *fsnotifyDirWatcher) watchClosest() error {
+	path := w.dir
+	for {
+		err := w.addPath(w.watcher, path)
+		if err == nil {
+			break
+		}
+
+		parent := filepath.Dir(path)
+		if !errors.Is(err, fs.ErrNotExist) || parent == path {
+			return err
+		}
+		path = parent
+	}
+
+	if w.watched != "" && w.watched != path {
+		_ = w.watcher.Remove(w.watched)
+	}
+	w.watched = path
+	return nil
+}
+
+func (w *fsnotifyDirWatcher) sendEvent(event fsnotify.Event) bool {
+	select {
+	case w.events <- event:
+		return true
+	case <-w.closeCh:
+		return false
+	}
+}
+
+func (w *fsnotifyDirWatcher) sendError(err error) bool {
+	select {
+	case w.errors <- err:
+		return true
+	case <-w.closeCh:
+		return false
+	}
+}
@@ -15,9 +15,11 @@
 package filewatcher
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -27,36 +29,279 @@ import (
 // FakeWatcher implementation below.
 type NewFileWatcherFunc func() FileWatcher
 
+// fakeBufferSize is the capacity of the channels returned by Events and Errors.
+const fakeBufferSize = 1000
+
 // FakeWatcher provides a fake file watcher implementation for unit
 // tests. Production code should use the `NewWatcher()`.
+//
+// Injection never blocks: events and errors for a path which isn't watched
+// are queued, and delivered once the path is added or subscribed to. Those
+// which don't fit in a full channel are dropped, and counted by Dropped.
 type FakeWatcher struct {
 	sync.Mutex
 
 	events      map[string]chan fsnotify.Event
 	errors      map[string]chan error
+	options     map[string]*watchOptions
+	subs        map[string][]*sink
 	changedFunc func(path string, added bool)
+
+	// events and errors injected for paths which aren't watched yet
+	pendingChanges map[string][]Change
+	pendingErrors  map[string][]error
+
+	// history of the watched paths
+	added   []string
+	removed []string
+	dropped int
+
+	// in-memory filesystem content, see WriteFile
+	files map[string][]byte
+
+	// set by Close, after which Subscribe fails with ErrClosed
+	closed bool
 }
 
-// InjectEvent injects an event into the fake file watcher.
+// InjectEvent injects an event into the fake file watcher. Subscriptions
+// receive a Change whose kind is derived from the event, without digests nor
+// file metadata.
 func (w *FakeWatcher) InjectEvent(path string, event fsnotify.Event) {
 	w.Lock()
-	ch, ok := w.events[path]
-	w.Unlock()
+	defer w.Unlock()
+	w.injectChange(path, Change{Path: path, Kind: changeKindOf(event.Op), Event: event})
+}
+
+// InjectChange injects a change into the fake file watcher. The event of the
+// change is delivered as well.
+func (w *FakeWatcher) InjectChange(path string, change Change) {
+	w.Lock()
+	defer w.Unlock()
+	w.injectChange(path, change)
+}
+
+func (w *FakeWatcher) injectChange(path string, change Change) {
+	if !w.watched(path) {
+		w.pendingChanges[path] = append(w.pendingChanges[path], change)
+		return
+	}
 
-	if ok {
-		ch <- event
+	if ch, ok := w.events[path]; ok {
+		w.sendEvent(ch, change.Event)
+	}
+	for _, s := range w.subs[path] {
+		w.sendEvent(s.events, change.Event)
+		w.sendChange(s.changes, change)
 	}
 }
 
 // InjectError injects an error into the fake file watcher.
 func (w *FakeWatcher) InjectError(path string, err error) {
 	w.Lock()
-	ch, ok := w.errors[path]
+	defer w.Unlock()
+
+	if !w.watched(path) {
+		w.pendingErrors[path] = append(w.pendingErrors[path], err)
+		return
+	}
+
+	if ch, ok := w.errors[path]; ok {
+		w.sendError(ch, err)
+	}
+	for _, s := range w.subs[path] {
+		w.sendError(s.errors, err)
+	}
+}
+
+func (w *FakeWatcher) sendEvent(ch chan fsnotify.Event, event fsnotify.Event) {
+	select {
+	case ch <- event:
+	default:
+		w.dropped++
+	}
+}
+
+func (w *FakeWatcher) sendChange(ch chan Change, change Change) {
+	select {
+	case ch <- change:
+	default:
+		w.dropped++
+	}
+}
+
+func (w *FakeWatcher) sendError(ch chan error, err error) {
+	select {
+	case ch <- err:
+	default:
+		w.dropped++
+	}
+}
+
+// watched returns whether path has been added or subscribed to.
+func (w *FakeWatcher) watched(path string) bool {
+	_, ok := w.events[path]
+	return ok || len(w.subs[path]) > 0
+}
+
+// deliverPending sends the changes and errors queued for path to the given
+// channels. changes is nil for paths added with Add.
+func (w *FakeWatcher) deliverPending(path string, events chan fsnotify.Event, changes chan Change, errs chan error) {
+	for _, change := range w.pendingChanges[path] {
+		w.sendEvent(events, change.Event)
+		if changes != nil {
+			w.sendChange(changes, change)
+		}
+	}
+	for _, err := range w.pendingErrors[path] {
+		w.sendError(errs, err)
+	}
+	delete(w.pendingChanges, path)
+	delete(w.pendingErrors, path)
+}
+
+// Added returns the paths passed to Add and Subscribe so far, in order.
+func (w *FakeWatcher) Added() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.added...)
+}
+
+// Removed returns the paths passed to Remove, and those of closed
+// subscriptions so far, in order.
+func (w *FakeWatcher) Removed() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.removed...)
+}
+
+// Dropped returns the number of events, changes and errors which have been
+// dropped because the receiving channel was full.
+func (w *FakeWatcher) Dropped() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.dropped
+}
+
+// WriteFile simulates writing data to the file at path in memory. A create
+// event is injected for a new file, and a write event if the content changed.
+// Writing the same content again injects nothing, unless the path is watched
+// with AlwaysDetector.
+func (w *FakeWatcher) WriteFile(path string, data []byte) {
+	w.Lock()
+	defer w.Unlock()
+
+	prev, existed := w.files[path]
+	w.files[path] = append([]byte(nil), data...)
+
+	change := Change{
+		Path:      path,
+		NewDigest: fakeDigest(data),
+		Size:      int64(len(data)),
+		ModTime:   time.Now(),
+	}
+	switch {
+	case !existed:
+		change.Kind = ChangeCreated
+		change.Event = fsnotify.Event{Name: path, Op: fsnotify.Create}
+	case w.detectorOf(path).Changed(fakeDigest(prev), change.NewDigest):
+		change.Kind = ChangeModified
+		change.OldDigest = fakeDigest(prev)
+		change.Event = fsnotify.Event{Name: path, Op: fsnotify.Write}
+	default:
+		return
+	}
+	w.injectChange(path, change)
+}
+
+// RemoveFile simulates removing the file at path from memory. A remove event
+// is injected if the file existed.
+func (w *FakeWatcher) RemoveFile(path string) {
+	w.Lock()
+	defer w.Unlock()
+
+	if _, ok := w.files[path]; !ok {
+		return
+	}
+	w.injectChange(path, Change{
+		Path:      path,
+		Kind:      ChangeRemoved,
+		OldDigest: fakeDigest(w.files[path]),
+		Event:     fsnotify.Event{Name: path, Op: fsnotify.Remove},
+	})
+	delete(w.files, path)
+}
+
+// ReadFile returns the content last written to path with WriteFile.
+func (w *FakeWatcher) ReadFile(path string) ([]byte, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	data, ok := w.files[path]
+	return append([]byte(nil), data...), ok
+}
+
+// detectorOf returns the change detector configured for path, which is used
+// to compare the simulated digests of its content.
+func (w *FakeWatcher) detectorOf(path string) ChangeDetector {
+	if opts, ok := w.options[path]; ok {
+		return opts.detector
+	}
+	return SHA256Detector()
+}
+
+// fakeDigest simulates the digest of in-memory content.
+func fakeDigest(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// Pending returns the number of events and errors waiting to be received on
+// the channels of path.
+func (w *FakeWatcher) Pending(path string) int {
+	w.Lock()
+	defer w.Unlock()
+
+	n := len(w.events[path]) + len(w.errors[path])
+	for _, s := range w.subs[path] {
+		n += len(s.events) + len(s.errors)
+	}
+	return n
+}
+
+// TestingT is the subset of testing.TB used by the assertions of FakeWatcher,
+// so that production binaries don't link the testing package.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...any)
+}
+
+// AssertNoEvents fails the test if any event or error is waiting to be received
+// for path. As injection is synchronous, no further event can arrive unless
+// more are injected.
+func (w *FakeWatcher) AssertNoEvents(t TestingT, path string) {
+	t.Helper()
+	if n := w.Pending(path); n > 0 {
+		t.Fatalf("%d unexpected events or errors pending for %s", n, path)
+	}
+}
+
+// InjectSymlinkSwap simulates the redirection of the symlink at path from
+// oldTarget to newTarget, as done on Kubernetes ConfigMap and Secret updates.
+// The swap handler registered for the path is called, and a create event is
+// injected, as the real watcher would do.
+func (w *FakeWatcher) InjectSymlinkSwap(path, oldTarget, newTarget string) {
+	w.Lock()
+	opts, ok := w.options[path]
 	w.Unlock()
 
-	if ok {
-		ch <- err
+	if !ok {
+		return
+	}
+
+	if opts.onSwap != nil {
+		opts.onSwap(SymlinkSwap{Path: path, OldTarget: oldTarget, NewTarget: newTarget})
 	}
+	w.InjectEvent(path, fsnotify.Event{Name: path, Op: fsnotify.Create})
 }
 
 // NewFakeWatcher returns a function which creates a new fake watcher for unit
@@ -67,7 +312,13 @@ func NewFakeWatcher(changedFunc func(path string, added bool)) (NewFileWatcherFu
 	w := &FakeWatcher{
 		events:      make(map[string]chan fsnotify.Event),
 		errors:      make(map[string]chan error),
+		options:     make(map[string]*watchOptions),
+		subs:        make(map[string][]*sink),
 		changedFunc: changedFunc,
+
+		pendingChanges: make(map[string][]Change),
+		pendingErrors:  make(map[string][]error),
+		files:          make(map[string][]byte),
 	}
 	return func() FileWatcher {
 		return w
@@ -76,6 +327,11 @@ func NewFakeWatcher(changedFunc func(path string, added bool)) (NewFileWatcherFu
 
 // Add is a fake implementation of the FileWatcher interface.
 func (w *FakeWatcher) Add(path string) error {
+	return w.AddWithOptions(path)
+}
+
+// AddWithOptions is a fake implementation of the SubscribingWatcher interface.
+func (w *FakeWatcher) AddWithOptions(path string, opts ...WatchOption) error {
 	w.Lock()
 
 	// w.events and w.errors are always updated togeather. We only check
@@ -85,8 +341,13 @@ func (w *FakeWatcher) Add(path string) error {
 		return fmt.Errorf("path %v already exists", path)
 	}
 
-	w.events[path] = make(chan fsnotify.Event, 1000)
-	w.errors[path] = make(chan error, 1000)
+	w.events[path] = make(chan fsnotify.Event, fakeBufferSize)
+	w.errors[path] = make(chan error, fakeBufferSize)
+	if _, ok := w.options[path]; !ok {
+		w.options[path] = newWatchOptions(opts)
+	}
+	w.added = append(w.added, path)
+	w.deliverPending(path, w.events[path], nil, w.errors[path])
 
 	w.Unlock()
 
@@ -107,15 +368,75 @@ func (w *FakeWatcher) Remove(path string) error {
 
 	delete(w.events, path)
 	delete(w.errors, path)
+	if len(w.subs[path]) == 0 {
+		delete(w.options, path)
+	}
+	w.removed = append(w.removed, path)
 	if w.changedFunc != nil {
 		w.changedFunc(path, false)
 	}
 	return nil
 }
 
+// Subscribe is a fake implementation of the SubscribingWatcher interface.
+func (w *FakeWatcher) Subscribe(path string, opts ...WatchOption) (*Subscription, error) {
+	o := newWatchOptions(opts)
+	s := newSink(false, o.bufferSize)
+
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return nil, ErrClosed
+	}
+	if _, ok := w.options[path]; !ok {
+		w.options[path] = o
+	}
+	w.subs[path] = append(w.subs[path], s)
+	w.added = append(w.added, path)
+	w.deliverPending(path, s.events, s.changes, s.errors)
+	w.Unlock()
+
+	if w.changedFunc != nil {
+		w.changedFunc(path, true)
+	}
+	return newSubscription(path, s, func() error {
+		return w.unsubscribe(path, s)
+	}), nil
+}
+
+func (w *FakeWatcher) unsubscribe(path string, s *sink) error {
+	w.Lock()
+	defer w.Unlock()
+
+	subs := w.subs[path]
+	for i, other := range subs {
+		if other != s {
+			continue
+		}
+
+		w.subs[path] = append(subs[:i:i], subs[i+1:]...)
+		if len(w.subs[path]) == 0 {
+			delete(w.subs, path)
+			if _, ok := w.events[path]; !ok {
+				delete(w.options, path)
+			}
+		}
+		retireSink(s)
+		w.removed = append(w.removed, path)
+		if w.changedFunc != nil {
+			w.changedFunc(path, false)
+		}
+		return nil
+	}
+
+	// the subscription has been closed along with the watcher
+	return nil
+}
+
 // Close is a fake implementation of the FileWatcher interface.
 func (w *FakeWatcher) Close() error {
 	w.Lock()
+	w.closed = true
 	for path, ch := range w.events {
 		close(ch)
 		delete(w.events, path)
@@ -124,6 +445,15 @@ func (w *FakeWatcher) Close() error {
 		close(ch)
 		delete(w.errors, path)
 	}
+	for path := range w.options {
+		delete(w.options, path)
+	}
+	for path, subs := range w.subs {
+		for _, s := range subs {
+			retireSink(s)
+		}
+		delete(w.subs, path)
+	}
 	defer w.Unlock()
 	return nil
 }
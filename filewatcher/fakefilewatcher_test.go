@@ -15,6 +15,7 @@
 package filewatcher
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -137,3 +138,188 @@ func TestFakeFileWatcher(t *testing.T) {
 		}
 	}
 }
+
+func TestFakeFileWatcherSymlinkSwap(t *testing.T) {
+	newWatcher, fakeWatcher := NewFakeWatcher(nil)
+	watcher := newWatcher().(SubscribingWatcher)
+
+	var got []SymlinkSwap
+	if err := watcher.AddWithOptions("foo", WithSymlinkSwapHandler(func(s SymlinkSwap) { got = append(got, s) })); err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+
+	fakeWatcher.InjectSymlinkSwap("foo", "..v1/foo", "..v2/foo")
+
+	wantEvent := fsnotify.Event{Name: "foo", Op: fsnotify.Create}
+	if gotEvent := <-watcher.Events("foo"); gotEvent != wantEvent {
+		t.Fatalf("Events() failed: got %v want %v", gotEvent, wantEvent)
+	}
+	want := SymlinkSwap{Path: "foo", OldTarget: "..v1/foo", NewTarget: "..v2/foo"}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("swap handler failed: got %v want %v", got, want)
+	}
+}
+
+func TestFakeFileWatcherSubscribe(t *testing.T) {
+	newWatcher, fakeWatcher := NewFakeWatcher(nil)
+	watcher := newWatcher().(SubscribingWatcher)
+
+	sub1, err := watcher.Subscribe("foo")
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+	sub2, err := watcher.Subscribe("foo")
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+
+	wantEvent := fsnotify.Event{Name: "foo", Op: fsnotify.Write}
+	fakeWatcher.InjectEvent("foo", wantEvent)
+	for _, sub := range []*Subscription{sub1, sub2} {
+		if gotEvent := <-sub.Events(); gotEvent != wantEvent {
+			t.Fatalf("Events() failed: got %v want %v", gotEvent, wantEvent)
+		}
+	}
+
+	if err := sub1.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+	if _, ok := <-sub1.Events(); ok {
+		t.Fatal("Events() not closed after Close()")
+	}
+
+	wantError := errors.New("error=foo")
+	fakeWatcher.InjectError("foo", wantError)
+	if gotError := <-sub2.Errors(); gotError != wantError {
+		t.Fatalf("Errors() failed: got %v want %v", gotError, wantError)
+	}
+
+	if err := watcher.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if _, ok := <-sub2.Events(); ok {
+		t.Fatal("Events() not closed after watcher Close()")
+	}
+	if err := sub2.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+}
+
+func TestFakeFileWatcherNonBlocking(t *testing.T) {
+	newWatcher, fakeWatcher := NewFakeWatcher(nil)
+	watcher := newWatcher().(SubscribingWatcher)
+
+	// events injected before Add are delivered once the path is watched
+	wantEvent := fsnotify.Event{Name: "foo", Op: fsnotify.Create}
+	fakeWatcher.InjectEvent("foo", wantEvent)
+	wantError := errors.New("error=foo")
+	fakeWatcher.InjectError("foo", wantError)
+	if err := watcher.Add("foo"); err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+	if gotEvent := <-watcher.Events("foo"); gotEvent != wantEvent {
+		t.Fatalf("Events() failed: got %v want %v", gotEvent, wantEvent)
+	}
+	if gotError := <-watcher.Errors("foo"); gotError != wantError {
+		t.Fatalf("Errors() failed: got %v want %v", gotError, wantError)
+	}
+	fakeWatcher.AssertNoEvents(t, "foo")
+
+	// injection into a full channel doesn't block
+	for i := 0; i < fakeBufferSize+2; i++ {
+		fakeWatcher.InjectEvent("foo", fsnotify.Event{Name: "foo", Op: fsnotify.Write})
+	}
+	if got := fakeWatcher.Dropped(); got != 2 {
+		t.Fatalf("Dropped() failed: got %v want 2", got)
+	}
+	if got := fakeWatcher.Pending("foo"); got != fakeBufferSize {
+		t.Fatalf("Pending() failed: got %v want %v", got, fakeBufferSize)
+	}
+
+	if err := watcher.Remove("foo"); err != nil {
+		t.Fatalf("Remove() returned error: %v", err)
+	}
+	sub, err := watcher.Subscribe("bar")
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+	if err := sub.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+
+	if got, want := fakeWatcher.Added(), []string{"foo", "bar"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Added() failed: got %v want %v", got, want)
+	}
+	if got, want := fakeWatcher.Removed(), []string{"foo", "bar"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Removed() failed: got %v want %v", got, want)
+	}
+}
+
+func TestFakeFileWatcherInMemoryFiles(t *testing.T) {
+	newWatcher, fakeWatcher := NewFakeWatcher(nil)
+	watcher := newWatcher().(SubscribingWatcher)
+
+	if err := watcher.Add("foo"); err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+
+	expect := func(op fsnotify.Op) {
+		t.Helper()
+		wantEvent := fsnotify.Event{Name: "foo", Op: op}
+		if gotEvent := <-watcher.Events("foo"); gotEvent != wantEvent {
+			t.Fatalf("Events() failed: got %v want %v", gotEvent, wantEvent)
+		}
+	}
+
+	fakeWatcher.WriteFile("foo", []byte("v1"))
+	expect(fsnotify.Create)
+	fakeWatcher.WriteFile("foo", []byte("v2"))
+	expect(fsnotify.Write)
+
+	// identical content is not a change
+	fakeWatcher.WriteFile("foo", []byte("v2"))
+	fakeWatcher.AssertNoEvents(t, "foo")
+	if data, ok := fakeWatcher.ReadFile("foo"); !ok || string(data) != "v2" {
+		t.Fatalf("ReadFile() failed: got %q, %v want \"v2\", true", data, ok)
+	}
+
+	fakeWatcher.RemoveFile("foo")
+	expect(fsnotify.Remove)
+	fakeWatcher.RemoveFile("foo")
+	fakeWatcher.AssertNoEvents(t, "foo")
+
+	// the configured change detector is honored
+	if err := watcher.AddWithOptions("bar", WithChangeDetector(AlwaysDetector())); err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+	fakeWatcher.WriteFile("bar", []byte("v1"))
+	fakeWatcher.WriteFile("bar", []byte("v1"))
+	if got := fakeWatcher.Pending("bar"); got != 2 {
+		t.Fatalf("Pending() failed: got %v want 2", got)
+	}
+}
+
+func TestFakeFileWatcherChanges(t *testing.T) {
+	newWatcher, fakeWatcher := NewFakeWatcher(nil)
+	watcher := newWatcher().(SubscribingWatcher)
+
+	sub, err := watcher.Subscribe("foo")
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %v", err)
+	}
+
+	fakeWatcher.WriteFile("foo", []byte("v1"))
+	fakeWatcher.WriteFile("foo", []byte("v2"))
+	created, modified := <-sub.Changes(), <-sub.Changes()
+	if created.Kind != ChangeCreated || modified.Kind != ChangeModified {
+		t.Fatalf("Changes() failed: got %v, %v want created, modified", created.Kind, modified.Kind)
+	}
+	if string(modified.OldDigest) != string(created.NewDigest) || modified.Size != 2 {
+		t.Fatalf("Changes() failed: got %+v", modified)
+	}
+
+	fakeWatcher.InjectEvent("foo", fsnotify.Event{Name: "foo", Op: fsnotify.Rename})
+	if got := <-sub.Changes(); got.Kind != ChangeRenamed {
+		t.Fatalf("Changes() failed: got %v want renamed", got.Kind)
+	}
+}
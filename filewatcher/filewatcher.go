@@ -23,6 +23,9 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
+// ErrClosed is returned when using a watcher which has been closed.
+var ErrClosed = errors.New("using a closed watcher")
+
 // FileWatcher is an interface that watches a set of files,
 // delivering events to related channel.
 type FileWatcher interface {
@@ -36,6 +39,23 @@ type FileWatcher interface {
 	Errors(path string) chan error
 }
 
+// SubscribingWatcher is a FileWatcher taking options per path, and supporting
+// several independent watches of a path. The watchers of this package
+// implement it. It is kept apart from FileWatcher so that other
+// implementations of FileWatcher keep satisfying it, and Watch falls back to
+// Add for them.
+type SubscribingWatcher interface {
+	FileWatcher
+
+	// AddWithOptions is Add, with options configuring how changes to the path
+	// are detected.
+	AddWithOptions(path string, opts ...WatchOption) error
+
+	// Subscribe starts an independent watch on a path. Unlike Add, it may be
+	// called any number of times for the same path.
+	Subscribe(path string, opts ...WatchOption) (*Subscription, error)
+}
+
 type fileWatcher struct {
 	mu sync.RWMutex
 
@@ -43,6 +63,7 @@ type fileWatcher struct {
 	// keyed by watched dir (parent dir of watched files).
 	workers map[string]*workerState
 
+	opts  *watcherOptions
 	funcs *patchTable
 }
 
@@ -53,14 +74,23 @@ type workerState struct {
 
 // functions that can be replaced in a test setting
 type patchTable struct {
-	newWatcher     func() (*fsnotify.Watcher, error)
-	addWatcherPath func(*fsnotify.Watcher, string) error
+	newWatcher      func() (*fsnotify.Watcher, error)
+	addWatcherPath  func(*fsnotify.Watcher, string) error
+	supportsInotify func(string) bool
 }
 
 // NewWatcher return with a FileWatcher instance that implemented with fsnotify.
 func NewWatcher() FileWatcher {
+	return NewWatcherWithOptions()
+}
+
+// NewWatcherWithOptions returns a SubscribingWatcher instance configured with
+// the given options. It is implemented with fsnotify, and falls back to
+// polling directories where fsnotify can't be used.
+func NewWatcherWithOptions(opts ...Option) SubscribingWatcher {
 	return &fileWatcher{
 		workers: map[string]*workerState{},
+		opts:    newWatcherOptions(opts),
 
 		// replaceable functions for tests
 		funcs: &patchTable{
@@ -68,6 +98,7 @@ func NewWatcher() FileWatcher {
 			addWatcherPath: func(watcher *fsnotify.Watcher, path string) error {
 				return watcher.Add(path)
 			},
+			supportsInotify: supportsInotify,
 		},
 	}
 }
@@ -87,6 +118,11 @@ func (fw *fileWatcher) Close() error {
 
 // Add a path to watch
 func (fw *fileWatcher) Add(path string) error {
+	return fw.AddWithOptions(path)
+}
+
+// AddWithOptions adds a path to watch, configured with the given options
+func (fw *fileWatcher) AddWithOptions(path string, opts ...WatchOption) error {
 	fw.mu.Lock()
 	defer fw.mu.Unlock()
 
@@ -95,7 +131,7 @@ func (fw *fileWatcher) Add(path string) error {
 		return err
 	}
 
-	if err = ws.worker.addPath(cleanedPath); err == nil {
+	if err = ws.worker.addPath(cleanedPath, newWatchOptions(opts)); err == nil {
 		ws.count++
 	}
 
@@ -113,11 +149,55 @@ func (fw *fileWatcher) Remove(path string) error {
 	}
 
 	if err = ws.worker.removePath(cleanedPath); err == nil {
-		ws.count--
-		if ws.count == 0 {
-			ws.worker.terminate()
-			delete(fw.workers, parentPath)
-		}
+		fw.release(ws, parentPath)
+	}
+
+	return err
+}
+
+// release drops a reference to a worker, terminating it along with the last one.
+func (fw *fileWatcher) release(ws *workerState, parentPath string) {
+	ws.count--
+	if ws.count == 0 {
+		ws.worker.terminate()
+		delete(fw.workers, parentPath)
+	}
+}
+
+// Subscribe starts an independent watch on a path
+func (fw *fileWatcher) Subscribe(path string, opts ...WatchOption) (*Subscription, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	ws, cleanedPath, _, err := fw.getWorker(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := ws.worker.addSubscriber(cleanedPath, newWatchOptions(opts))
+	ws.count++
+
+	return newSubscription(cleanedPath, s, func() error {
+		return fw.unsubscribe(path, s)
+	}), nil
+}
+
+func (fw *fileWatcher) unsubscribe(path string, s *sink) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.workers == nil {
+		// the channels have been closed along with the watcher
+		return nil
+	}
+
+	ws, cleanedPath, parentPath, err := fw.findWorkerWithParent(path)
+	if err != nil {
+		return err
+	}
+
+	if err = ws.worker.removeSubscriber(cleanedPath, s); err == nil {
+		fw.release(ws, parentPath)
 	}
 
 	return err
@@ -151,7 +231,7 @@ func (fw *fileWatcher) Errors(path string) chan error {
 
 func (fw *fileWatcher) getWorker(path string) (*workerState, string, string, error) {
 	if fw.workers == nil {
-		return nil, "", "", errors.New("using a closed watcher")
+		return nil, "", "", ErrClosed
 	}
 
 	cleanedPath := filepath.Clean(path)
@@ -159,7 +239,7 @@ func (fw *fileWatcher) getWorker(path string) (*workerState, string, string, err
 
 	ws, workerExists := fw.workers[parentPath]
 	if !workerExists {
-		wk, err := newWorker(parentPath, fw.funcs)
+		wk, err := newWorker(parentPath, fw.funcs, fw.opts)
 		if err != nil {
 			return nil, "", "", err
 		}
@@ -175,8 +255,13 @@ func (fw *fileWatcher) getWorker(path string) (*workerState, string, string, err
 }
 
 func (fw *fileWatcher) findWorker(path string) (*workerState, string, error) {
+	ws, cleanedPath, _, err := fw.findWorkerWithParent(path)
+	return ws, cleanedPath, err
+}
+
+func (fw *fileWatcher) findWorkerWithParent(path string) (*workerState, string, string, error) {
 	if fw.workers == nil {
-		return nil, "", errors.New("using a closed watcher")
+		return nil, "", "", ErrClosed
 	}
 
 	cleanedPath := filepath.Clean(path)
@@ -184,8 +269,8 @@ func (fw *fileWatcher) findWorker(path string) (*workerState, string, error) {
 
 	ws, workerExists := fw.workers[parentPath]
 	if !workerExists {
-		return nil, "", fmt.Errorf("no path registered for %s", path)
+		return nil, "", "", fmt.Errorf("no path registered for %s", path)
 	}
 
-	return ws, cleanedPath, nil
+	return ws, cleanedPath, parentPath, nil
 }
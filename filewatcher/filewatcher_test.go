@@ -21,8 +21,10 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"runtime"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -142,6 +144,42 @@ func newSymlinkedWatchFile(t *testing.T) (string, string, func()) {
 	return watchDir, watchFile, cleanup
 }
 
+// newConfigMapWatchFile lays out a directory the way Kubernetes mounts a
+// ConfigMap or Secret volume:
+//
+//	<watchDir>/test.conf -> ..data/test.conf
+//	<watchDir>/..data -> ..v1
+//	<watchDir>/..v1/test.conf
+func newConfigMapWatchFile(t *testing.T) (string, string, func()) {
+	g := NewGomegaWithT(t)
+
+	watchDir, err := os.MkdirTemp("", "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(os.Mkdir(path.Join(watchDir, "..v1"), 0o777)).To(Succeed())
+	g.Expect(os.WriteFile(path.Join(watchDir, "..v1", "test.conf"), []byte("foo: bar\n"), 0o640)).To(Succeed())
+	g.Expect(os.Symlink("..v1", path.Join(watchDir, "..data"))).To(Succeed())
+
+	watchFile := path.Join(watchDir, "test.conf")
+	g.Expect(os.Symlink(path.Join("..data", "test.conf"), watchFile)).To(Succeed())
+
+	cleanup := func() {
+		os.RemoveAll(watchDir)
+	}
+	return watchDir, watchFile, cleanup
+}
+
+// swapConfigMap updates a directory created by newConfigMapWatchFile the way
+// the kubelet does.
+func swapConfigMap(t *testing.T, watchDir, version, content string) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(os.Mkdir(path.Join(watchDir, version), 0o777)).To(Succeed())
+	g.Expect(os.WriteFile(path.Join(watchDir, version, "test.conf"), []byte(content), 0o640)).To(Succeed())
+	g.Expect(os.Symlink(version, path.Join(watchDir, "..data_tmp"))).To(Succeed())
+	g.Expect(os.Rename(path.Join(watchDir, "..data_tmp"), path.Join(watchDir, "..data"))).To(Succeed())
+}
+
 func TestWatchFile(t *testing.T) {
 	t.Run("file content changed", func(t *testing.T) {
 		g := NewGomegaWithT(t)
@@ -152,7 +190,7 @@ func TestWatchFile(t *testing.T) {
 		_, err := os.Stat(watchFile)
 		g.Expect(err).NotTo(HaveOccurred())
 
-		w := NewWatcher()
+		w := NewWatcherWithOptions()
 		w.Add(watchFile)
 		events := w.Events(watchFile)
 
@@ -181,7 +219,7 @@ func TestWatchFile(t *testing.T) {
 		watchDir, watchFile, cleanup := newSymlinkedWatchFile(t)
 		defer cleanup()
 
-		w := NewWatcher()
+		w := NewWatcherWithOptions()
 		w.Add(watchFile)
 		events := w.Events(watchFile)
 
@@ -218,7 +256,7 @@ func TestWatchFile(t *testing.T) {
 		watchFile, cleanup := newWatchFileThatDoesNotExist(t)
 		defer cleanup()
 
-		w := NewWatcher()
+		w := NewWatcherWithOptions()
 		w.Add(watchFile)
 		events := w.Events(watchFile)
 
@@ -238,13 +276,417 @@ func TestWatchFile(t *testing.T) {
 	})
 }
 
+func TestChangeDetectors(t *testing.T) {
+	cases := []struct {
+		name     string
+		detector ChangeDetector
+		content  string
+		want     bool
+	}{
+		{"sha256 same content", SHA256Detector(), "foo: bar\n", false},
+		{"sha256 new content", SHA256Detector(), "foo: baz\n", true},
+		{"mtime and size new content", ModTimeSizeDetector(), "foo: bazz\n", true},
+		{"always same content", AlwaysDetector(), "foo: bar\n", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			watchFile, cleanup := newWatchFile(t)
+			defer cleanup()
+
+			w := NewWatcherWithOptions()
+			defer func() { _ = w.Close() }()
+			g.Expect(w.AddWithOptions(watchFile, WithChangeDetector(c.detector))).To(Succeed())
+			events := w.Events(watchFile)
+
+			err := os.WriteFile(watchFile, []byte(c.content), 0o640)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			if c.want {
+				g.Eventually(events).Should(Receive())
+			} else {
+				g.Consistently(events, 200*time.Millisecond).ShouldNot(Receive())
+			}
+		})
+	}
+}
+
+func TestWatchFileIgnoresSiblings(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile1, watchFile2, cleanup := newTwoWatchFile(t)
+	defer cleanup()
+
+	w := NewWatcherWithOptions()
+	defer func() { _ = w.Close() }()
+	g.Expect(w.AddWithOptions(watchFile1, WithChangeDetector(AlwaysDetector()))).To(Succeed())
+
+	// Changes to another file in the same directory are not reported.
+	err := os.WriteFile(watchFile2, []byte("foo: qux\n"), 0o640)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Consistently(w.Events(watchFile1), 200*time.Millisecond).ShouldNot(Receive())
+}
+
+func TestDebounce(t *testing.T) {
+	t.Run("bursts are coalesced", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		watchFile, cleanup := newWatchFile(t)
+		defer cleanup()
+
+		w := NewWatcherWithOptions()
+		defer func() { _ = w.Close() }()
+		g.Expect(w.AddWithOptions(watchFile, WithDebounce(200*time.Millisecond, 0))).To(Succeed())
+		events := w.Events(watchFile)
+
+		for i := 0; i < 5; i++ {
+			err := os.WriteFile(watchFile, []byte(fmt.Sprintf("foo: %d\n", i)), 0o640)
+			g.Expect(err).NotTo(HaveOccurred())
+		}
+
+		g.Eventually(events).Should(Receive())
+		g.Consistently(events, 400*time.Millisecond).ShouldNot(Receive())
+	})
+
+	t.Run("no-op bursts are suppressed", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		watchFile, cleanup := newWatchFile(t)
+		defer cleanup()
+
+		w := NewWatcherWithOptions()
+		defer func() { _ = w.Close() }()
+		g.Expect(w.AddWithOptions(watchFile, WithDebounce(100*time.Millisecond, 0))).To(Succeed())
+
+		// Truncate and write back the original content.
+		g.Expect(os.WriteFile(watchFile, nil, 0o640)).To(Succeed())
+		g.Expect(os.WriteFile(watchFile, []byte("foo: bar\n"), 0o640)).To(Succeed())
+
+		g.Consistently(w.Events(watchFile), 400*time.Millisecond).ShouldNot(Receive())
+	})
+
+	t.Run("max delay bounds constant changes", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		watchFile, cleanup := newWatchFile(t)
+		defer cleanup()
+
+		w := NewWatcherWithOptions()
+		defer func() { _ = w.Close() }()
+		g.Expect(w.AddWithOptions(watchFile, WithDebounce(200*time.Millisecond, 300*time.Millisecond))).To(Succeed())
+		events := w.Events(watchFile)
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				case <-time.After(20 * time.Millisecond):
+					_ = os.WriteFile(watchFile, []byte(fmt.Sprintf("foo: %d\n", i)), 0o640)
+				}
+			}
+		}()
+
+		g.Eventually(events, time.Second).Should(Receive())
+	})
+}
+
+func TestConfigMapSymlinkSwap(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test as symlink replacements don't work on non-linux environment...")
+	}
+
+	for _, content := range []string{"foo: baz\n", "foo: bar\n"} {
+		t.Run(content, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			watchDir, watchFile, cleanup := newConfigMapWatchFile(t)
+			defer cleanup()
+
+			swaps := make(chan SymlinkSwap, 10)
+			w := NewWatcherWithOptions()
+			defer func() { _ = w.Close() }()
+			err := w.AddWithOptions(watchFile, WithSymlinkSwapHandler(func(s SymlinkSwap) { swaps <- s }))
+			g.Expect(err).NotTo(HaveOccurred())
+			events := w.Events(watchFile)
+
+			swapConfigMap(t, watchDir, "..v2", content)
+			g.Expect(os.RemoveAll(path.Join(watchDir, "..v1"))).To(Succeed())
+
+			// A single event is reported per swap, even if the content is the same.
+			var event fsnotify.Event
+			g.Eventually(events).Should(Receive(&event))
+			g.Expect(event).To(Equal(fsnotify.Event{Name: watchFile, Op: fsnotify.Create}))
+			g.Consistently(events, 200*time.Millisecond).ShouldNot(Receive())
+
+			resolvedDir, err := filepath.EvalSymlinks(watchDir)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(swaps).To(Receive(Equal(SymlinkSwap{
+				Path:      watchFile,
+				OldTarget: path.Join(resolvedDir, "..v1", "test.conf"),
+				NewTarget: path.Join(resolvedDir, "..v2", "test.conf"),
+			})))
+		})
+	}
+}
+
+func TestPollingWatcher(t *testing.T) {
+	t.Run("file content changed", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		watchFile, cleanup := newWatchFile(t)
+		defer cleanup()
+
+		w := NewWatcherWithOptions(WithPolling(10 * time.Millisecond))
+		defer func() { _ = w.Close() }()
+		g.Expect(w.Add(watchFile)).To(Succeed())
+
+		g.Expect(os.WriteFile(watchFile, []byte("foo: bazz\n"), 0o640)).To(Succeed())
+		g.Eventually(w.Events(watchFile)).Should(Receive(Equal(fsnotify.Event{Name: watchFile, Op: fsnotify.Write})))
+	})
+
+	t.Run("file added later and removed", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		watchFile, cleanup := newWatchFileThatDoesNotExist(t)
+		defer cleanup()
+
+		w := NewWatcherWithOptions(WithPolling(10 * time.Millisecond))
+		defer func() { _ = w.Close() }()
+		g.Expect(w.Add(watchFile)).To(Succeed())
+		events := w.Events(watchFile)
+
+		g.Expect(os.WriteFile(watchFile, []byte("foo: baz\n"), 0o640)).To(Succeed())
+		g.Eventually(events).Should(Receive(Equal(fsnotify.Event{Name: watchFile, Op: fsnotify.Create})))
+
+		g.Expect(os.Remove(watchFile)).To(Succeed())
+		g.Eventually(events).Should(Receive(Equal(fsnotify.Event{Name: watchFile, Op: fsnotify.Remove})))
+	})
+
+	t.Run("configmap symlink swap", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+
+		watchDir, watchFile, cleanup := newConfigMapWatchFile(t)
+		defer cleanup()
+
+		w := NewWatcherWithOptions(WithPolling(10 * time.Millisecond))
+		defer func() { _ = w.Close() }()
+		g.Expect(w.Add(watchFile)).To(Succeed())
+
+		swapConfigMap(t, watchDir, "..v2", "foo: baz\n")
+		g.Eventually(w.Events(watchFile)).Should(Receive(Equal(fsnotify.Event{Name: watchFile, Op: fsnotify.Create})))
+	})
+}
+
+func TestPollingFallback(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test as inotify is only available on linux")
+	}
+
+	cases := []struct {
+		name  string
+		patch func(*patchTable)
+	}{
+		{
+			name: "unsupported filesystem",
+			patch: func(funcs *patchTable) {
+				funcs.supportsInotify = func(string) bool { return false }
+			},
+		},
+		{
+			name: "out of inotify watches",
+			patch: func(funcs *patchTable) {
+				funcs.addWatcherPath = func(*fsnotify.Watcher, string) error { return syscall.ENOSPC }
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			watchFile, cleanup := newWatchFile(t)
+			defer cleanup()
+
+			w := NewWatcherWithOptions(WithPollingFallback(10 * time.Millisecond))
+			defer func() { _ = w.Close() }()
+			c.patch(w.(*fileWatcher).funcs)
+			g.Expect(w.Add(watchFile)).To(Succeed())
+
+			g.Expect(os.WriteFile(watchFile, []byte("foo: bazz\n"), 0o640)).To(Succeed())
+			g.Eventually(w.Events(watchFile)).Should(Receive())
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		w := NewWatcherWithOptions(WithPollingFallback(0))
+		w.(*fileWatcher).funcs.addWatcherPath = func(*fsnotify.Watcher, string) error {
+			return syscall.ENOSPC
+		}
+
+		name, _ := newWatchFile(t)
+		if err := w.Add(name); err == nil {
+			t.Errorf("Expecting error, got nil")
+		}
+		_ = w.Close()
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	w := NewWatcherWithOptions()
+	defer func() { _ = w.Close() }()
+
+	g.Expect(w.Add(watchFile)).To(Succeed())
+	sub1, err := w.Subscribe(watchFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	sub2, err := w.Subscribe(watchFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sub1.Path()).To(Equal(watchFile))
+
+	// every subscriber and the Add channel get the event
+	events := w.Events(watchFile)
+	g.Expect(os.WriteFile(watchFile, []byte("foo: baz\n"), 0o640)).To(Succeed())
+	g.Eventually(events).Should(Receive())
+	g.Eventually(sub1.Events()).Should(Receive())
+	g.Eventually(sub2.Events()).Should(Receive())
+
+	// closing a subscription leaves the others in place
+	g.Expect(sub1.Close()).To(Succeed())
+	g.Expect(sub1.Close()).To(Succeed())
+	g.Eventually(sub1.Events()).Should(BeClosed())
+	g.Expect(w.Remove(watchFile)).To(Succeed())
+	g.Expect(w.Events(watchFile)).To(BeNil())
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: qux\n"), 0o640)).To(Succeed())
+	g.Eventually(sub2.Events()).Should(Receive())
+
+	// the worker goes away with the last subscription
+	g.Expect(sub2.Close()).To(Succeed())
+	g.Eventually(sub2.Events()).Should(BeClosed())
+	g.Expect(w.(*fileWatcher).workers).To(BeEmpty())
+}
+
+func TestSubscribeSlowReader(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	w := NewWatcherWithOptions()
+	defer func() { _ = w.Close() }()
+
+	slow, err := w.Subscribe(watchFile, WithChangeDetector(AlwaysDetector()), WithBufferSize(1))
+	g.Expect(err).NotTo(HaveOccurred())
+	fast, err := w.Subscribe(watchFile)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// a subscriber which doesn't read doesn't hold up the others
+	for i := 0; i < 5; i++ {
+		g.Expect(os.WriteFile(watchFile, []byte(fmt.Sprintf("foo: %d\n", i)), 0o640)).To(Succeed())
+		g.Eventually(fast.Events()).Should(Receive())
+	}
+	g.Expect(slow.Events()).To(HaveLen(1))
+}
+
+func TestSubscribeChanges(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	w := NewWatcherWithOptions()
+	defer func() { _ = w.Close() }()
+
+	sub, err := w.Subscribe(watchFile)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// waitFor skips the changes of other kinds, as writes may be reported
+	// more than once
+	waitFor := func(kind ChangeKind) Change {
+		var c Change
+		g.Eventually(func() ChangeKind {
+			select {
+			case c = <-sub.Changes():
+				return c.Kind
+			default:
+				return 0
+			}
+		}).Should(Equal(kind))
+		return c
+	}
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: baz\n"), 0o640)).To(Succeed())
+	c := waitFor(ChangeModified)
+	g.Expect(c.Path).To(Equal(watchFile))
+	g.Expect(c.NewDigest).NotTo(Equal(c.OldDigest))
+
+	g.Expect(os.Remove(watchFile)).To(Succeed())
+	c = waitFor(ChangeRemoved)
+	g.Expect(c.Path).To(Equal(watchFile))
+	g.Expect(c.OldDigest).NotTo(BeEmpty())
+	g.Expect(c.NewDigest).To(BeEmpty())
+	g.Expect(c.ModTime.IsZero()).To(BeTrue())
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: qux\n"), 0o640)).To(Succeed())
+	c = waitFor(ChangeCreated)
+	g.Expect(c.OldDigest).To(BeEmpty())
+	g.Expect(c.ModTime.IsZero()).To(BeFalse())
+
+	g.Expect(os.Rename(watchFile, watchFile+".old")).To(Succeed())
+	waitFor(ChangeRenamed)
+}
+
+func TestWatchFileInMissingDirectory(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchDir, err := os.MkdirTemp("", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(watchDir)
+
+	dataDir := path.Join(watchDir, "a", "b")
+	watchFile := path.Join(dataDir, "test.conf")
+
+	w := NewWatcherWithOptions()
+	defer func() { _ = w.Close() }()
+	g.Expect(w.Add(watchFile)).To(Succeed())
+	events := w.Events(watchFile)
+
+	// the directories appear one after the other
+	g.Expect(os.Mkdir(path.Join(watchDir, "a"), 0o777)).To(Succeed())
+	g.Expect(os.Mkdir(dataDir, 0o777)).To(Succeed())
+	g.Expect(os.WriteFile(watchFile, []byte("foo: bar\n"), 0o640)).To(Succeed())
+	g.Eventually(events).Should(Receive(WithTransform(func(e fsnotify.Event) string { return e.Name }, Equal(watchFile))))
+
+	// the directory is deleted
+	g.Expect(os.RemoveAll(path.Join(watchDir, "a"))).To(Succeed())
+	g.Eventually(events).Should(Receive(Equal(fsnotify.Event{Name: watchFile, Op: fsnotify.Remove})))
+
+	// and recreated along with the file at once
+	g.Expect(os.MkdirAll(dataDir, 0o777)).To(Succeed())
+	g.Expect(os.WriteFile(watchFile, []byte("foo: baz\n"), 0o640)).To(Succeed())
+	g.Eventually(events).Should(Receive(WithTransform(func(e fsnotify.Event) string { return e.Name }, Equal(watchFile))))
+
+	// and the file keeps being watched
+	g.Expect(os.WriteFile(watchFile, []byte("foo: qux\n"), 0o640)).To(Succeed())
+	g.Eventually(events).Should(Receive())
+}
+
 func TestWatcherLifecycle(t *testing.T) {
 	g := NewGomegaWithT(t)
 
 	watchFile1, watchFile2, cleanup := newTwoWatchFile(t)
 	defer cleanup()
 
-	w := NewWatcher()
+	w := NewWatcherWithOptions()
 
 	// Validate Add behavior
 	err := w.Add(watchFile1)
@@ -290,7 +732,7 @@ func TestWatcherLifecycle(t *testing.T) {
 }
 
 func TestErrors(t *testing.T) {
-	w := NewWatcher()
+	w := NewWatcherWithOptions()
 
 	if ch := w.Errors("XYZ"); ch != nil {
 		t.Error("Expected no channel")
@@ -332,7 +774,7 @@ func TestErrors(t *testing.T) {
 }
 
 func TestBadWatcher(t *testing.T) {
-	w := NewWatcher()
+	w := NewWatcherWithOptions()
 	w.(*fileWatcher).funcs.newWatcher = func() (*fsnotify.Watcher, error) {
 		return nil, errors.New("FOOBAR")
 	}
@@ -347,7 +789,7 @@ func TestBadWatcher(t *testing.T) {
 }
 
 func TestBadAddWatcher(t *testing.T) {
-	w := NewWatcher()
+	w := NewWatcherWithOptions()
 	w.(*fileWatcher).funcs.addWatcherPath = func(*fsnotify.Watcher, string) error {
 		return errors.New("FOOBAR")
 	}
@@ -362,7 +804,7 @@ func TestBadAddWatcher(t *testing.T) {
 }
 
 func TestDuplicateAdd(t *testing.T) {
-	w := NewWatcher()
+	w := NewWatcherWithOptions()
 
 	name, _ := newWatchFile(t)
 
@@ -378,7 +820,7 @@ func TestDuplicateAdd(t *testing.T) {
 }
 
 func TestBogusRemove(t *testing.T) {
-	w := NewWatcher()
+	w := NewWatcherWithOptions()
 
 	name, _ := newWatchFile(t)
 	if err := w.Remove(name); err == nil {
@@ -475,7 +917,7 @@ func TestChurn(t *testing.T) {
 	workers := 5
 	filesPerWorker := 15
 
-	w := NewWatcher()
+	w := NewWatcherWithOptions()
 	defer func() { _ = w.Close() }()
 
 	done := make(chan struct{})
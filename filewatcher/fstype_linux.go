@@ -0,0 +1,52 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Magic numbers of filesystems on which inotify doesn't report changes made
+// by other hosts or by the filesystem daemon. See statfs(2).
+var noInotifyFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x65735546: "fuse",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x517b:     "smb",
+	0x01021997: "9p",
+}
+
+// supportsInotify reports whether inotify works on the filesystem of the
+// given path. Paths which can't be stat'ed are assumed to support it.
+func supportsInotify(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return true
+	}
+	_, unsupported := noInotifyFilesystems[uint32(st.Type)]
+	return !unsupported
+}
+
+// inotifyUnavailable reports whether err indicates that inotify can't be used,
+// either because it is not supported, or because the per-user limits on
+// instances or watches have been reached.
+func inotifyUnavailable(err error) bool {
+	return errors.Is(err, syscall.ENOSYS) ||
+		errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENOSPC) ||
+		errors.Is(err, syscall.EOPNOTSUPP)
+}
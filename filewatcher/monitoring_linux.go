@@ -0,0 +1,106 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Note that this code uses go.opencensus.io/stats, which is only built on
+// Linux, as in the version package.
+
+var (
+	pathTagKey = tag.MustNewKey("path")
+
+	rawEvents = stats.Int64(
+		"filewatcher/events_total",
+		"Raw events received for watched directories",
+		stats.UnitDimensionless)
+	changes = stats.Int64(
+		"filewatcher/changes_total",
+		"Changes notified for watched files",
+		stats.UnitDimensionless)
+	duplicates = stats.Int64(
+		"filewatcher/duplicates_total",
+		"Events suppressed because the watched file did not change",
+		stats.UnitDimensionless)
+	watchErrors = stats.Int64(
+		"filewatcher/errors_total",
+		"Errors notified for watched files",
+		stats.UnitDimensionless)
+	hashDuration = stats.Float64(
+		"filewatcher/hash_duration_seconds",
+		"Time spent computing the digest of watched files",
+		stats.UnitSeconds)
+)
+
+func init() {
+	countView := func(m stats.Measure) *view.View {
+		return &view.View{
+			Measure:     m,
+			TagKeys:     []tag.Key{pathTagKey},
+			Aggregation: view.Count(),
+		}
+	}
+
+	if err := view.Register(
+		countView(rawEvents),
+		countView(changes),
+		countView(duplicates),
+		countView(watchErrors),
+		&view.View{
+			Measure:     hashDuration,
+			TagKeys:     []tag.Key{pathTagKey},
+			Aggregation: view.Distribution(.0001, .0005, .001, .005, .01, .05, .1, .5, 1),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+func record(path string, m stats.Measurement) {
+	ctx, err := tag.New(context.Background(), tag.Insert(pathTagKey, path))
+	if err != nil {
+		scope.Errorf("could not tag %s metrics: %v", path, err)
+		return
+	}
+	stats.Record(ctx, m)
+}
+
+// recordEvent counts a raw event received for the watched directory dir.
+func recordEvent(dir string) {
+	record(dir, rawEvents.M(1))
+}
+
+func recordChange(path string) {
+	record(path, changes.M(1))
+}
+
+func recordDuplicate(path string) {
+	record(path, duplicates.M(1))
+}
+
+func recordError(path string) {
+	record(path, watchErrors.M(1))
+}
+
+func recordHashDuration(path string, d time.Duration) {
+	record(path, hashDuration.M(d.Seconds()))
+}
@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// countFor returns the value of a count view for the given path.
+func countFor(g *WithT, name, path string) int64 {
+	rows, err := view.RetrieveData(name)
+	g.Expect(err).NotTo(HaveOccurred())
+	for _, row := range rows {
+		for _, t := range row.Tags {
+			if t == (tag.Tag{Key: pathTagKey, Value: path}) {
+				return row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	w := NewWatcherWithOptions()
+	defer func() { _ = w.Close() }()
+	sub, err := w.Subscribe(watchFile)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: baz\n"), 0o640)).To(Succeed())
+	g.Eventually(sub.Events()).Should(Receive())
+	g.Eventually(func() int64 { return countFor(g, "filewatcher/changes_total", watchFile) }).Should(BeNumerically(">", 0))
+
+	// a chmod leaves the content unchanged and is suppressed
+	g.Expect(os.Chmod(watchFile, 0o600)).To(Succeed())
+	g.Eventually(func() int64 { return countFor(g, "filewatcher/duplicates_total", watchFile) }).Should(BeNumerically(">", 0))
+	g.Expect(countFor(g, "filewatcher/events_total", filepath.Dir(watchFile))).To(BeNumerically(">", 0))
+}
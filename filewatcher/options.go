@@ -0,0 +1,162 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import "time"
+
+// defaultBufferSize is the default capacity of the channels of a Subscription.
+const defaultBufferSize = 16
+
+// Default delays between retries of Watch.
+const (
+	defaultRetryInitial = 100 * time.Millisecond
+	defaultRetryMax     = 30 * time.Second
+)
+
+// defaultPollInterval is the interval at which directories are polled when
+// the watcher falls back to polling automatically.
+const defaultPollInterval = time.Second
+
+// Option configures a FileWatcher created with NewWatcherWithOptions.
+type Option func(*watcherOptions)
+
+type watcherOptions struct {
+	pollInterval     time.Duration
+	fallbackInterval time.Duration
+}
+
+func newWatcherOptions(opts []Option) *watcherOptions {
+	o := &watcherOptions{
+		fallbackInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPolling makes the watcher poll directories at the given interval
+// instead of relying on fsnotify.
+func WithPolling(interval time.Duration) Option {
+	return func(o *watcherOptions) {
+		o.pollInterval = interval
+	}
+}
+
+// WithPollingFallback sets the interval at which directories are polled when
+// fsnotify can't be used, either because the filesystem is known not to
+// support inotify (e.g. NFS or FUSE), or because inotify is out of resources.
+// A non-positive interval disables the fallback.
+func WithPollingFallback(interval time.Duration) Option {
+	return func(o *watcherOptions) {
+		o.fallbackInterval = interval
+	}
+}
+
+// WatchOption configures how a single path is watched. The options of the
+// first Add or Subscribe call for a path determine how changes to it are
+// detected, until the path is no longer watched. Later calls only apply the
+// options that concern their own channels.
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	detector ChangeDetector
+	quiet    time.Duration
+	maxDelay time.Duration
+	onSwap   func(SymlinkSwap)
+
+	bufferSize int
+
+	// used by Watch
+	watcher      FileWatcher
+	retryInitial time.Duration
+	retryMax     time.Duration
+}
+
+func newWatchOptions(opts []WatchOption) *watchOptions {
+	o := &watchOptions{
+		detector:     SHA256Detector(),
+		bufferSize:   defaultBufferSize,
+		retryInitial: defaultRetryInitial,
+		retryMax:     defaultRetryMax,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithChangeDetector sets the ChangeDetector used to decide whether an event
+// for the path is forwarded. SHA256Detector is used by default.
+func WithChangeDetector(d ChangeDetector) WatchOption {
+	return func(o *watchOptions) {
+		if d != nil {
+			o.detector = d
+		}
+	}
+}
+
+// WithDebounce coalesces the events received for the path, so that a single
+// notification is delivered once the file has been stable for the quiet
+// period. If maxDelay is positive, a notification is delivered at the latest
+// maxDelay after the first coalesced event, even if the file keeps changing.
+func WithDebounce(quiet, maxDelay time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.quiet = quiet
+		o.maxDelay = maxDelay
+	}
+}
+
+// WithSymlinkSwapHandler registers a function that is called whenever the
+// watched path is a symlink which has been redirected to a new target, such
+// as on a Kubernetes ConfigMap or Secret update. It is called before the
+// corresponding event is delivered, and must not block.
+func WithSymlinkSwapHandler(fn func(SymlinkSwap)) WatchOption {
+	return func(o *watchOptions) {
+		o.onSwap = fn
+	}
+}
+
+// WithBufferSize sets the capacity of the channels of a Subscription.
+// Notifications are dropped for a subscription whose channels are full, since
+// it already has a notification pending. It has no effect on Add.
+func WithBufferSize(size int) WatchOption {
+	return func(o *watchOptions) {
+		if size > 0 {
+			o.bufferSize = size
+		}
+	}
+}
+
+// WithFileWatcher makes Watch use the given watcher, rather than creating
+// one for the call.
+func WithFileWatcher(fw FileWatcher) WatchOption {
+	return func(o *watchOptions) {
+		o.watcher = fw
+	}
+}
+
+// WithRetryBackoff sets the delays between the retries of Watch, which start
+// at initial and double up to max.
+func WithRetryBackoff(initial, max time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		if initial > 0 {
+			o.retryInitial = initial
+		}
+		if max >= o.retryInitial {
+			o.retryMax = max
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pollingDirWatcher watches a directory by listing its entries periodically,
+// for filesystems on which fsnotify never fires, such as NFS or FUSE mounts.
+// It synthesizes the events fsnotify would have delivered: Create for new
+// entries and redirected symlinks, Write for entries whose size or
+// modification time changed, Chmod for entries whose mode changed, and
+// Remove for entries which disappeared.
+type pollingDirWatcher struct {
+	path     string
+	interval time.Duration
+
+	events chan fsnotify.Event
+	errors chan error
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	doneCh    chan struct{}
+}
+
+// entryState is the state of a directory entry as seen by the poller.
+type entryState struct {
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+
+	// link is the destination of the entry if it is a symlink.
+	link string
+}
+
+func newPollingDirWatcher(path string, interval time.Duration) *pollingDirWatcher {
+	w := &pollingDirWatcher{
+		path:     path,
+		interval: interval,
+		events:   make(chan fsnotify.Event),
+		errors:   make(chan error),
+		closeCh:  make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+
+	// entries which exist when the watch starts are not reported
+	entries, _ := w.scan()
+	go w.poll(entries)
+
+	return w
+}
+
+func (w *pollingDirWatcher) Events() <-chan fsnotify.Event {
+	return w.events
+}
+
+func (w *pollingDirWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *pollingDirWatcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.closeCh)
+	})
+	<-w.doneCh
+	return nil
+}
+
+func (w *pollingDirWatcher) poll(entries map[string]entryState) {
+	defer close(w.doneCh)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.closeCh:
+			return
+		}
+
+		current, err := w.scan()
+		if err != nil {
+			if !w.sendError(err) {
+				return
+			}
+			continue
+		}
+
+		for _, event := range diffEntries(w.path, entries, current) {
+			if !w.sendEvent(event) {
+				return
+			}
+		}
+		entries = current
+	}
+}
+
+func (w *pollingDirWatcher) sendEvent(event fsnotify.Event) bool {
+	select {
+	case w.events <- event:
+		return true
+	case <-w.closeCh:
+		return false
+	}
+}
+
+func (w *pollingDirWatcher) sendError(err error) bool {
+	select {
+	case w.errors <- err:
+		return true
+	case <-w.closeCh:
+		return false
+	}
+}
+
+// scan lists the entries of the directory. A directory which does not exist
+// is reported as empty.
+func (w *pollingDirWatcher) scan() (map[string]entryState, error) {
+	dirEntries, err := os.ReadDir(w.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]entryState{}, nil
+		}
+		return nil, err
+	}
+
+	entries := make(map[string]entryState, len(dirEntries))
+	for _, de := range dirEntries {
+		info, err := de.Info()
+		if err != nil {
+			// the entry was removed since the directory was read
+			continue
+		}
+
+		state := entryState{
+			mode:    info.Mode(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			state.link, _ = os.Readlink(filepath.Join(w.path, de.Name()))
+		}
+		entries[de.Name()] = state
+	}
+
+	return entries, nil
+}
+
+// diffEntries returns the events that turn the prev listing of dir into cur.
+func diffEntries(dir string, prev, cur map[string]entryState) []fsnotify.Event {
+	var events []fsnotify.Event
+
+	for name, c := range cur {
+		event := fsnotify.Event{Name: filepath.Join(dir, name)}
+
+		p, ok := prev[name]
+		switch {
+		case !ok || p.link != c.link || p.mode.Type() != c.mode.Type():
+			event.Op = fsnotify.Create
+		case p.size != c.size || !p.modTime.Equal(c.modTime):
+			event.Op = fsnotify.Write
+		case p.mode != c.mode:
+			event.Op = fsnotify.Chmod
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,150 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sort"
+)
+
+// Stats is a snapshot of what a watcher is watching, for introspection.
+type Stats struct {
+	Workers []WorkerStats `json:"workers"`
+}
+
+// WorkerStats describes the worker watching a directory.
+type WorkerStats struct {
+	Dir string `json:"dir"`
+
+	// Polling is set when the directory is polled rather than watched with
+	// fsnotify.
+	Polling bool `json:"polling"`
+
+	Paths []PathStats `json:"paths"`
+}
+
+// PathStats describes a watched file.
+type PathStats struct {
+	Path string `json:"path"`
+
+	// Added is set when the path was added with Add.
+	Added bool `json:"added"`
+
+	// Subscribers is the number of subscriptions for the path.
+	Subscribers int `json:"subscribers"`
+}
+
+// Stats returns a snapshot of the workers of the watcher, sorted by directory.
+func (fw *fileWatcher) Stats() Stats {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	stats := Stats{Workers: []WorkerStats{}}
+	for _, ws := range fw.workers {
+		stats.Workers = append(stats.Workers, ws.worker.stats())
+	}
+	sort.Slice(stats.Workers, func(i, j int) bool {
+		return stats.Workers[i].Dir < stats.Workers[j].Dir
+	})
+	return stats
+}
+
+func (wk *worker) stats() WorkerStats {
+	wk.mu.RLock()
+	defer wk.mu.RUnlock()
+
+	_, polling := wk.dirWatcher.(*pollingDirWatcher)
+	result := WorkerStats{Dir: wk.dir, Polling: polling, Paths: []PathStats{}}
+	for path, ft := range wk.watchedFiles {
+		ps := PathStats{Path: path}
+		for _, s := range ft.sinks {
+			if s.primary {
+				ps.Added = true
+			} else {
+				ps.Subscribers++
+			}
+		}
+		result.Paths = append(result.Paths, ps)
+	}
+	sortPaths(result.Paths)
+	return result
+}
+
+// Stats returns a snapshot of the watched paths, grouped by directory as the
+// real watcher would.
+func (w *FakeWatcher) Stats() Stats {
+	w.Lock()
+	defer w.Unlock()
+
+	paths := map[string]*PathStats{}
+	get := func(path string) *PathStats {
+		if paths[path] == nil {
+			paths[path] = &PathStats{Path: path}
+		}
+		return paths[path]
+	}
+	for path := range w.events {
+		get(path).Added = true
+	}
+	for path, subs := range w.subs {
+		get(path).Subscribers = len(subs)
+	}
+
+	workers := map[string]*WorkerStats{}
+	for path, ps := range paths {
+		dir := filepath.Dir(path)
+		if workers[dir] == nil {
+			workers[dir] = &WorkerStats{Dir: dir}
+		}
+		workers[dir].Paths = append(workers[dir].Paths, *ps)
+	}
+
+	stats := Stats{Workers: []WorkerStats{}}
+	for _, ws := range workers {
+		sortPaths(ws.Paths)
+		stats.Workers = append(stats.Workers, *ws)
+	}
+	sort.Slice(stats.Workers, func(i, j int) bool {
+		return stats.Workers[i].Dir < stats.Workers[j].Dir
+	})
+	return stats
+}
+
+func sortPaths(paths []PathStats) {
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Path < paths[j].Path
+	})
+}
+
+// DebugHandler returns an HTTP handler which serves the Stats of the watcher
+// as JSON. It responds with 501 if the watcher doesn't provide them.
+func DebugHandler(w FileWatcher) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		sp, ok := w.(interface{ Stats() Stats })
+		if !ok {
+			http.Error(rw, "watcher does not provide stats", http.StatusNotImplemented)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sp.Stats()); err != nil {
+			scope.Errorf("failed to write watcher stats: %v", err)
+		}
+	})
+}
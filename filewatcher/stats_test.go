@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStats(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	w := NewWatcherWithOptions()
+	defer func() { _ = w.Close() }()
+
+	g.Expect(w.Add(watchFile)).To(Succeed())
+	for i := 0; i < 2; i++ {
+		_, err := w.Subscribe(watchFile)
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+
+	want := Stats{Workers: []WorkerStats{{
+		Dir:   filepath.Dir(watchFile),
+		Paths: []PathStats{{Path: watchFile, Added: true, Subscribers: 2}},
+	}}}
+	g.Expect(w.(*fileWatcher).Stats()).To(Equal(want))
+
+	rec := httptest.NewRecorder()
+	DebugHandler(w).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/filewatcher", nil))
+	g.Expect(rec.Code).To(Equal(http.StatusOK))
+	var got Stats
+	g.Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+	g.Expect(got).To(Equal(want))
+}
+
+func TestFakeWatcherStats(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, w := NewFakeWatcher(nil)
+	g.Expect(w.Add("/a/foo")).To(Succeed())
+	g.Expect(w.Add("/b/bar")).To(Succeed())
+	_, err := w.Subscribe("/a/baz")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(w.Stats()).To(Equal(Stats{Workers: []WorkerStats{
+		{Dir: "/a", Paths: []PathStats{{Path: "/a/baz", Subscribers: 1}, {Path: "/a/foo", Added: true}}},
+		{Dir: "/b", Paths: []PathStats{{Path: "/b/bar", Added: true}}},
+	}}))
+}
+
+type noStatsWatcher struct {
+	FileWatcher
+}
+
+func TestDebugHandlerWithoutStats(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rec := httptest.NewRecorder()
+	DebugHandler(noStatsWatcher{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/filewatcher", nil))
+	g.Expect(rec.Code).To(Equal(http.StatusNotImplemented))
+}
@@ -0,0 +1,102 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Subscription is an independent watch on a path, created by
+// SubscribingWatcher.Subscribe. Any number of subscriptions may exist for the
+// same path, each with its own buffered channels.
+type Subscription struct {
+	path    string
+	events  <-chan fsnotify.Event
+	errors  <-chan error
+	changes <-chan Change
+
+	closeOnce sync.Once
+	closeErr  error
+	closeFn   func() error
+}
+
+func newSubscription(path string, s *sink, closeFn func() error) *Subscription {
+	return &Subscription{
+		path:    path,
+		events:  s.events,
+		errors:  s.errors,
+		changes: s.changes,
+		closeFn: closeFn,
+	}
+}
+
+// Path returns the watched path.
+func (s *Subscription) Path() string {
+	return s.path
+}
+
+// Events returns the event notification channel of the subscription. It is
+// closed when the subscription or its watcher is closed.
+func (s *Subscription) Events() <-chan fsnotify.Event {
+	return s.events
+}
+
+// Errors returns the error notification channel of the subscription. It is
+// closed when the subscription or its watcher is closed.
+func (s *Subscription) Errors() <-chan error {
+	return s.errors
+}
+
+// Changes returns the channel of the changes of the watched file. Each
+// notification on Events has a matching Change, delivered independently, so
+// either channel may be ignored. It is closed when the subscription or its
+// watcher is closed.
+func (s *Subscription) Changes() <-chan Change {
+	return s.changes
+}
+
+// Close stops the subscription. The path is no longer watched once all of its
+// subscriptions are closed and it has been removed. Calling Close multiple
+// times is safe.
+func (s *Subscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.closeFn()
+	})
+	return s.closeErr
+}
+
+// subscribe starts a watch on path with fw. Watchers which aren't a
+// SubscribingWatcher watch the path with Add instead, ignoring opts, so the
+// path can only be watched once at a time, and no change is delivered on
+// Changes.
+func subscribe(fw FileWatcher, path string, opts []WatchOption) (*Subscription, error) {
+	if sw, ok := fw.(SubscribingWatcher); ok {
+		return sw.Subscribe(path, opts...)
+	}
+
+	if err := fw.Add(path); err != nil {
+		return nil, err
+	}
+	return &Subscription{
+		path:   path,
+		events: fw.Events(path),
+		errors: fw.Errors(path),
+		closeFn: func() error {
+			return fw.Remove(path)
+		},
+	}, nil
+}
@@ -0,0 +1,40 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+// SymlinkSwap describes the redirection of a watched symbolic link to a new
+// target.
+//
+// Kubernetes updates mounted ConfigMaps and Secrets atomically. The volume
+// layout looks like:
+//
+//	<dir>/test.conf -> ..data/test.conf
+//	<dir>/..data -> ..2022_10_12_08_00_00.123456789
+//	<dir>/..2022_10_12_08_00_00.123456789/test.conf
+//
+// An update writes a new timestamped directory, and then renames a temporary
+// symlink over ..data. The events for that are reported on the ..data entry
+// rather than on the watched file. The watcher resolves the symlinks of the
+// watched file instead, and reports a single change per swap.
+type SymlinkSwap struct {
+	// Path is the watched path.
+	Path string
+
+	// OldTarget is the file the path resolved to before the swap.
+	OldTarget string
+
+	// NewTarget is the file the path resolves to after the swap.
+	NewTarget string
+}
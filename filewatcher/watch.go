@@ -0,0 +1,206 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"khetao.com/pkg/log"
+)
+
+var scope = log.RegisterScope("filewatcher", "File watcher messages", 0)
+
+// Watch calls fn for every event reported for path, until ctx is cancelled.
+//
+// Panics in fn are recovered. When fn fails, it is called again after a
+// backoff, with the most recent event received meanwhile. When the watcher
+// reports an error, the path is watched anew after a backoff, and an event
+// still failing is handled again. Watch returns nil once ctx is cancelled, or
+// an error if the watcher has been closed, ErrClosed if it was closed before
+// the path could be watched.
+//
+// A new watcher is created for the call and closed on return, unless one is
+// provided with WithFileWatcher.
+func Watch(ctx context.Context, path string, fn func(fsnotify.Event) error, opts ...WatchOption) error {
+	w, closeWatcher := newWatchLoop(ctx, path, fn, opts)
+	defer closeWatcher()
+	return w.run(nil)
+}
+
+type watchLoop struct {
+	ctx     context.Context
+	path    string
+	fn      func(fsnotify.Event) error
+	opts    []WatchOption
+	watcher FileWatcher
+	backoff *backoff
+
+	// the event not handled yet, kept across subscriptions
+	pending *fsnotify.Event
+}
+
+// newWatchLoop returns a loop for Watch, along with a function that closes the
+// watcher it uses if the loop owns it.
+func newWatchLoop(ctx context.Context, path string, fn func(fsnotify.Event) error, opts []WatchOption) (*watchLoop, func()) {
+	o := newWatchOptions(opts)
+
+	fw := o.watcher
+	closeWatcher := func() {}
+	if fw == nil {
+		fw = NewWatcher()
+		closeWatcher = func() { _ = fw.Close() }
+	}
+
+	return &watchLoop{
+		ctx:     ctx,
+		path:    path,
+		fn:      fn,
+		opts:    opts,
+		watcher: fw,
+		backoff: newBackoff(o.retryInitial, o.retryMax),
+	}, closeWatcher
+}
+
+// run watches the path until ctx is cancelled, starting with the given
+// subscription if it is not nil.
+func (w *watchLoop) run(sub *Subscription) error {
+	for {
+		if sub == nil {
+			var err error
+			if sub, err = subscribe(w.watcher, w.path, w.opts); err != nil {
+				if errors.Is(err, ErrClosed) {
+					return err
+				}
+				scope.Warnf("failed to watch %s, retrying: %v", w.path, err)
+				if !w.sleep(w.backoff.next()) {
+					return nil
+				}
+				continue
+			}
+		}
+
+		err := w.consume(sub)
+		_ = sub.Close()
+		sub = nil
+		if err != nil || w.ctx.Err() != nil {
+			return err
+		}
+
+		if !w.sleep(w.backoff.next()) {
+			return nil
+		}
+	}
+}
+
+// consume handles the notifications of the subscription. It returns nil once
+// ctx is cancelled or the subscription must be renewed after an error. An
+// event left pending by the previous subscription is handled first.
+func (w *watchLoop) consume(sub *Subscription) error {
+	var retry <-chan time.Time
+	if w.pending != nil {
+		retry = time.After(0)
+	}
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				return fmt.Errorf("watcher closed while watching %s", w.path)
+			}
+			w.pending = &event
+			if retry != nil {
+				// the next attempt uses the most recent event
+				continue
+			}
+
+		case err, ok := <-sub.Errors():
+			if !ok {
+				return fmt.Errorf("watcher closed while watching %s", w.path)
+			}
+			scope.Warnf("error watching %s, retrying: %v", w.path, err)
+			return nil
+
+		case <-retry:
+			retry = nil
+		}
+
+		if err := w.call(*w.pending); err != nil {
+			scope.Warnf("failed to handle event %v for %s, retrying: %v", *w.pending, w.path, err)
+			retry = time.After(w.backoff.next())
+			continue
+		}
+
+		w.pending = nil
+		w.backoff.reset()
+	}
+}
+
+// call invokes the handler, turning panics into errors.
+func (w *watchLoop) call(event fsnotify.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.fn(event)
+}
+
+// sleep waits for d, and returns false if ctx was cancelled meanwhile.
+func (w *watchLoop) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// backoff computes exponentially increasing delays between retries.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+func newBackoff(initial, max time.Duration) *backoff {
+	return &backoff{initial: initial, max: max}
+}
+
+func (b *backoff) next() time.Duration {
+	switch {
+	case b.current == 0:
+		b.current = b.initial
+	case b.current*2 > b.max:
+		b.current = b.max
+	default:
+		b.current *= 2
+	}
+	return b.current
+}
+
+func (b *backoff) reset() {
+	b.current = 0
+}
@@ -0,0 +1,191 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	. "github.com/onsi/gomega"
+)
+
+func TestWatch(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan fsnotify.Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, watchFile, func(e fsnotify.Event) error {
+			received <- e
+			return nil
+		})
+	}()
+
+	g.Eventually(func() bool {
+		_ = os.WriteFile(watchFile, []byte(time.Now().String()), 0o640)
+		return len(received) > 0
+	}).Should(BeTrue())
+
+	cancel()
+	g.Eventually(done).Should(Receive(BeNil()))
+}
+
+func TestWatchRetries(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	added := make(chan string, 10)
+	newWatcher, fakeWatcher := NewFakeWatcher(func(path string, isAdd bool) {
+		if isAdd {
+			added <- path
+		}
+	})
+	w := newWatcher()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	received := make(chan fsnotify.Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, "foo", func(e fsnotify.Event) error {
+			calls++
+			switch calls {
+			case 1:
+				panic("boom")
+			case 2:
+				return errors.New("transient")
+			}
+			received <- e
+			return nil
+		}, WithFileWatcher(w), WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+	}()
+
+	// a failing handler is called again with the same event
+	g.Eventually(added).Should(Receive(Equal("foo")))
+	event := fsnotify.Event{Name: "foo", Op: fsnotify.Write}
+	fakeWatcher.InjectEvent("foo", event)
+	g.Eventually(received).Should(Receive(Equal(event)))
+
+	// a watcher error renews the subscription
+	fakeWatcher.InjectError("foo", errors.New("overflow"))
+	g.Eventually(added).Should(Receive(Equal("foo")))
+
+	// closing the watcher ends the watch
+	g.Expect(w.Close()).To(Succeed())
+	g.Eventually(done).Should(Receive(HaveOccurred()))
+}
+
+func TestWatchClosedWatcher(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, fakeWatcher := NewFakeWatcher(nil)
+	for name, w := range map[string]FileWatcher{"real": NewWatcher(), "fake": fakeWatcher} {
+		g.Expect(w.Close()).To(Succeed())
+
+		done := make(chan error)
+		go func() {
+			done <- Watch(context.Background(), "foo", func(fsnotify.Event) error { return nil },
+				WithFileWatcher(w), WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+		}()
+		g.Eventually(done).Should(Receive(MatchError(ErrClosed)), name)
+	}
+}
+
+func TestWatchKeepsPendingEvent(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// the handler fails until the subscription is renewed
+	var failing atomic.Bool
+	failing.Store(true)
+	var adds atomic.Int32
+	added := make(chan string, 10)
+	newWatcher, fakeWatcher := NewFakeWatcher(func(path string, isAdd bool) {
+		if isAdd {
+			if adds.Add(1) == 2 {
+				failing.Store(false)
+			}
+			added <- path
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failures := make(chan struct{}, 100)
+	received := make(chan fsnotify.Event, 10)
+	go func() {
+		_ = Watch(ctx, "foo", func(e fsnotify.Event) error {
+			if failing.Load() {
+				failures <- struct{}{}
+				return errors.New("transient")
+			}
+			received <- e
+			return nil
+		}, WithFileWatcher(newWatcher()), WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+	}()
+
+	g.Eventually(added).Should(Receive(Equal("foo")))
+	event := fsnotify.Event{Name: "foo", Op: fsnotify.Write}
+	fakeWatcher.InjectEvent("foo", event)
+	g.Eventually(failures).Should(Receive())
+
+	// an error while the event is being retried renews the subscription, with
+	// which the event is handled again
+	fakeWatcher.InjectError("foo", errors.New("overflow"))
+	g.Eventually(added).Should(Receive(Equal("foo")))
+	g.Eventually(received).Should(Receive(Equal(event)))
+}
+
+func TestWatchPlainFileWatcher(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	added := make(chan string, 10)
+	_, fakeWatcher := NewFakeWatcher(func(path string, isAdd bool) {
+		if isAdd {
+			added <- path
+		}
+	})
+	// only the methods of FileWatcher, as other implementations provide
+	plain := struct{ FileWatcher }{fakeWatcher}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan fsnotify.Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, "foo", func(e fsnotify.Event) error {
+			received <- e
+			return nil
+		}, WithFileWatcher(plain))
+	}()
+
+	g.Eventually(added).Should(Receive(Equal("foo")))
+	event := fsnotify.Event{Name: "foo", Op: fsnotify.Write}
+	fakeWatcher.InjectEvent("foo", event)
+	g.Eventually(received).Should(Receive(Equal(event)))
+
+	cancel()
+	g.Eventually(done).Should(Receive(BeNil()))
+	g.Expect(fakeWatcher.Removed()).To(Equal([]string{"foo"}))
+}
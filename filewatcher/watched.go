@@ -0,0 +1,168 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"sigs.k8s.io/yaml"
+)
+
+// Watched is a value of type T loaded from a YAML or JSON file, and reloaded
+// whenever the content of the file changes. A new value only replaces the
+// current one if the file isn't empty, and its content can be decoded and
+// passes validation, so Get always returns the last good value, even while
+// the file is being rewritten.
+//
+//	cfg, err := filewatcher.NewWatched[Config]("/etc/app/config.yaml", validateConfig)
+//	if err != nil {
+//		return err
+//	}
+//	defer cfg.Close()
+//	cfg.OnChange(func(old, new Config) { ... })
+//	timeout := cfg.Get().Timeout
+type Watched[T any] struct {
+	path     string
+	validate func(T) error
+
+	value atomic.Pointer[T]
+
+	// guards listeners
+	mu        sync.Mutex
+	listeners []func(old, new T)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWatched loads the file at path into a value of type T, and keeps it up to
+// date. validate may be nil. An error is returned if the initial value can't
+// be loaded. The options configure how the file is watched, see Watch.
+func NewWatched[T any](path string, validate func(T) error, opts ...WatchOption) (*Watched[T], error) {
+	w := &Watched[T]{
+		path:     path,
+		validate: validate,
+		done:     make(chan struct{}),
+	}
+
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(context.Background())
+	loop, closeWatcher := newWatchLoop(ctx, path, w.onEvent, opts)
+
+	// subscribe before the initial load, so that no change is missed
+	sub, err := subscribe(loop.watcher, path, opts)
+	if err != nil {
+		w.cancel()
+		closeWatcher()
+		return nil, err
+	}
+
+	v, err := w.load()
+	if err != nil {
+		_ = sub.Close()
+		w.cancel()
+		closeWatcher()
+		return nil, err
+	}
+	w.value.Store(v)
+
+	go func() {
+		defer close(w.done)
+		defer closeWatcher()
+		if err := loop.run(sub); err != nil {
+			scope.Errorf("stopped watching %s: %v", path, err)
+		}
+	}()
+
+	return w, nil
+}
+
+// Get returns the current value.
+func (w *Watched[T]) Get() T {
+	return *w.value.Load()
+}
+
+// OnChange registers a function called with the previous and the new value
+// whenever a new value is loaded.
+func (w *Watched[T]) OnChange(fn func(old, new T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Close stops watching the file. Get keeps returning the last value.
+func (w *Watched[T]) Close() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+// onEvent is only called by the watching goroutine, so the listeners are called
+// in the order of the values.
+func (w *Watched[T]) onEvent(fsnotify.Event) error {
+	v, err := w.load()
+	if err != nil {
+		// keep the last good value, the next change will be loaded again
+		scope.Warnf("ignoring invalid content of %s: %v", w.path, err)
+		return nil
+	}
+
+	old := w.value.Swap(v)
+
+	// the listeners are called without holding the lock, so that they may call
+	// OnChange
+	w.mu.Lock()
+	listeners := make([]func(old, new T), len(w.listeners))
+	copy(listeners, w.listeners)
+	w.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(*old, *v)
+	}
+	return nil
+}
+
+// load reads, decodes and validates the file.
+func (w *Watched[T]) load() (*T, error) {
+	b, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty file would decode to the zero value, and is rather one being
+	// truncated before it is written
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, fmt.Errorf("%s is empty", w.path)
+	}
+
+	v := new(T)
+	if err := yaml.Unmarshal(b, v); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", w.path, err)
+	}
+
+	if w.validate != nil {
+		if err := w.validate(*v); err != nil {
+			return nil, fmt.Errorf("invalid content in %s: %v", w.path, err)
+		}
+	}
+
+	return v, nil
+}
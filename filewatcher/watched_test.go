@@ -0,0 +1,134 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+type testConfig struct {
+	Foo string `json:"foo"`
+}
+
+func validateTestConfig(c testConfig) error {
+	if c.Foo == "" {
+		return errors.New("foo is required")
+	}
+	return nil
+}
+
+func TestWatched(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	w, err := NewWatched(watchFile, validateTestConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = w.Close() }()
+	g.Expect(w.Get()).To(Equal(testConfig{Foo: "bar"}))
+
+	type change struct{ old, new testConfig }
+	changes := make(chan change, 10)
+	w.OnChange(func(old, new testConfig) {
+		changes <- change{old, new}
+	})
+
+	// JSON is accepted as well
+	g.Expect(os.WriteFile(watchFile, []byte(`{"foo": "baz"}`), 0o640)).To(Succeed())
+	g.Eventually(changes).Should(Receive(Equal(change{testConfig{Foo: "bar"}, testConfig{Foo: "baz"}})))
+	g.Expect(w.Get()).To(Equal(testConfig{Foo: "baz"}))
+
+	// invalid content keeps the last good value
+	g.Expect(os.WriteFile(watchFile, []byte("foo: \"\"\n"), 0o640)).To(Succeed())
+	g.Expect(os.WriteFile(watchFile, []byte("foo: [\n"), 0o640)).To(Succeed())
+	g.Consistently(changes, 200*time.Millisecond).ShouldNot(Receive())
+	g.Expect(w.Get()).To(Equal(testConfig{Foo: "baz"}))
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: qux\n"), 0o640)).To(Succeed())
+	g.Eventually(changes).Should(Receive(Equal(change{testConfig{Foo: "baz"}, testConfig{Foo: "qux"}})))
+}
+
+func TestWatchedInvalidInitialContent(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+	g.Expect(os.WriteFile(watchFile, []byte("foo: \"\"\n"), 0o640)).To(Succeed())
+
+	_, err := NewWatched(watchFile, validateTestConfig)
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = NewWatched[testConfig](watchFile+".missing", nil)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestWatchedEmptyContent(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	// without validation, an empty file would decode to the zero value
+	w, err := NewWatched[testConfig](watchFile, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = w.Close() }()
+
+	changes := make(chan testConfig, 10)
+	w.OnChange(func(_, new testConfig) {
+		changes <- new
+	})
+
+	g.Expect(os.Truncate(watchFile, 0)).To(Succeed())
+	g.Expect(os.WriteFile(watchFile, []byte(" \n\t\n"), 0o640)).To(Succeed())
+	g.Consistently(changes, 200*time.Millisecond).ShouldNot(Receive())
+	g.Expect(w.Get()).To(Equal(testConfig{Foo: "bar"}))
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: baz\n"), 0o640)).To(Succeed())
+	g.Eventually(changes).Should(Receive(Equal(testConfig{Foo: "baz"})))
+
+	g.Expect(os.Truncate(watchFile, 0)).To(Succeed())
+	_, err = NewWatched[testConfig](watchFile, nil)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestWatchedListenerRegistersListener(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	watchFile, cleanup := newWatchFile(t)
+	defer cleanup()
+
+	w, err := NewWatched(watchFile, validateTestConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = w.Close() }()
+
+	changes := make(chan testConfig, 10)
+	w.OnChange(func(_, _ testConfig) {
+		w.OnChange(func(_, new testConfig) {
+			changes <- new
+		})
+	})
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: baz\n"), 0o640)).To(Succeed())
+	g.Eventually(func() testConfig { return w.Get() }).Should(Equal(testConfig{Foo: "baz"}))
+
+	g.Expect(os.WriteFile(watchFile, []byte("foo: qux\n"), 0o640)).To(Succeed())
+	g.Eventually(changes).Should(Receive(Equal(testConfig{Foo: "qux"})))
+}
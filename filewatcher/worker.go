@@ -15,13 +15,12 @@
 package filewatcher
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/md5"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -29,9 +28,12 @@ import (
 type worker struct {
 	mu sync.RWMutex
 
-	// watcher is an fsnotify watcher that watches the parent
-	// dir of watchedFiles.
-	dirWatcher *fsnotify.Watcher
+	// dir is the watched directory.
+	dir string
+
+	// watcher is an fsnotify or polling watcher that watches
+	// the parent dir of watchedFiles.
+	dirWatcher dirWatcher
 
 	// The worker maintains a map of channels keyed by watched file path.
 	// The worker watches parent path of given path,
@@ -41,37 +43,113 @@ type worker struct {
 	// do not have to be related to the file itself.
 	watchedFiles map[string]*fileTracker
 
-	// tracker lifecycle
-	retireTrackerCh chan *fileTracker
+	// sink lifecycle
+	retireSinkCh chan *sink
+
+	// debounced notifications that are due
+	flushCh chan flushRequest
+
+	// closed when the worker has exited
+	doneCh chan struct{}
 
 	// tells the worker to exit
 	terminateCh chan bool
 }
 
 type fileTracker struct {
+	// sinks receive the notifications for the file. The slice is replaced
+	// rather than modified, and guarded by the worker's mutex.
+	sinks []*sink
+
+	// detector decides whether an event for the file is forwarded.
+	detector ChangeDetector
+
+	// digest of the file at the time of the last notification.
+	digest []byte
+
+	// exists tells whether the file existed at the time of the last
+	// notification.
+	exists bool
+
+	// symlink is set when the file is a symbolic link, in which case
+	// events for other entries of the directory may change its content.
+	symlink bool
+
+	// target is the file the path resolves to once all symbolic links are
+	// followed, or empty if it can't be resolved.
+	target string
+
+	// onSwap is called when target changes, see WithSymlinkSwapHandler.
+	onSwap func(SymlinkSwap)
+
+	// debounce settings, see WithDebounce.
+	quiet    time.Duration
+	maxDelay time.Duration
+
+	// pending is the latest event received during the current quiet
+	// period, or nil if no notification is pending.
+	pending      *fsnotify.Event
+	pendingSince time.Time
+	timer        *time.Timer
+
+	// generation is bumped whenever the timer is re-armed, so that
+	// stale flush requests can be recognized.
+	generation uint64
+}
+
+// sink is a set of channels notifications for a file are delivered to. It
+// is created either by Add, in which case the channels are unbuffered and the
+// worker blocks until notifications are received, or by Subscribe, in which
+// case the channels are buffered and notifications are dropped when full.
+type sink struct {
 	events chan fsnotify.Event
 	errors chan error
 
-	// md5 sum to indicate if a file has been updated.
-	md5Sum []byte
+	// changes is only delivered to subscriptions.
+	changes chan Change
+
+	// primary is set for the sink created by Add.
+	primary bool
+
+	// closed is set once the channels have been closed.
+	// used only by the worker goroutine
+	closed bool
 }
 
-func newWorker(path string, funcs *patchTable) (*worker, error) {
-	dirWatcher, err := funcs.newWatcher()
-	if err != nil {
-		return nil, err
+func newSink(primary bool, size int) *sink {
+	if primary {
+		size = 0
 	}
+	return &sink{
+		events:  make(chan fsnotify.Event, size),
+		errors:  make(chan error, size),
+		changes: make(chan Change, size),
+		primary: primary,
+	}
+}
 
-	if err = funcs.addWatcherPath(dirWatcher, path); err != nil {
-		_ = dirWatcher.Close()
+// flushRequest asks the worker to deliver the pending notification of a
+// tracker once its quiet period has elapsed.
+type flushRequest struct {
+	path       string
+	ft         *fileTracker
+	generation uint64
+}
+
+func newWorker(path string, funcs *patchTable, opts *watcherOptions) (*worker, error) {
+	dirWatcher, err := newDirWatcher(path, funcs, opts)
+	if err != nil {
 		return nil, err
 	}
 
 	wk := &worker{
-		dirWatcher:      dirWatcher,
-		watchedFiles:    make(map[string]*fileTracker),
-		retireTrackerCh: make(chan *fileTracker),
-		terminateCh:     make(chan bool),
+		dir:          filepath.Clean(path),
+		dirWatcher:   dirWatcher,
+		watchedFiles: make(map[string]*fileTracker),
+		retireSinkCh: make(chan *sink),
+		flushCh:      make(chan flushRequest),
+		doneCh:       make(chan struct{}),
+		terminateCh:  make(chan bool),
 	}
 
 	go wk.listen()
@@ -81,40 +159,81 @@ func newWorker(path string, funcs *patchTable) (*worker, error) {
 
 func (wk *worker) listen() {
 	wk.loop()
+	close(wk.doneCh)
 
 	_ = wk.dirWatcher.Close()
 
-	// drain any retiring trackers that may be pending
-	wk.drainRetiringTrackers()
+	// drain any retiring sinks that may be pending
+	wk.drainRetiringSinks()
 
 	// clean up the rest
-	for _, ft := range wk.watchedFiles {
-		retireTracker(ft)
+	for _, ft := range wk.getTrackers() {
+		if ft.timer != nil {
+			ft.timer.Stop()
+		}
+		for _, s := range wk.sinksOf(ft) {
+			retireSink(s)
+		}
 	}
 }
 
 func (wk *worker) loop() {
 	for {
 		select {
-		case event := <-wk.dirWatcher.Events:
-			// work on a copy of the watchedFiles map, so that we don't interfere
-			// with the caller's use of the map
-			for path, ft := range wk.getTrackers() {
-				if ft.events == nil {
-					// tracker has been retired, skip it
+		case event := <-wk.dirWatcher.Events():
+			recordEvent(wk.dir)
+			for path, ft := range wk.trackersFor(event) {
+				if !ft.concerns(path, event.Name) {
 					continue
 				}
 
-				sum := getMd5Sum(path)
-				if !bytes.Equal(sum, ft.md5Sum) {
-					ft.md5Sum = sum
+				if ft.quiet > 0 {
+					wk.schedule(path, ft, event)
+					continue
+				}
+
+				if !wk.check(path, ft, event) {
+					return
+				}
+			}
+
+		case req := <-wk.flushCh:
+			ft := req.ft
+			if len(wk.sinksOf(ft)) == 0 || ft.pending == nil || req.generation != ft.generation {
+				// tracker has been retired or re-armed meanwhile, skip it
+				continue
+			}
+
+			event := *ft.pending
+			ft.pending = nil
+
+			if !wk.check(req.path, ft, event) {
+				return
+			}
+
+		case err := <-wk.dirWatcher.Errors():
+			for path, ft := range wk.getTrackers() {
+				recordError(path)
+				for _, s := range wk.sinksOf(ft) {
+					if s.closed {
+						// sink has been retired, skip it
+						continue
+					}
+
+					if !s.primary {
+						select {
+						case s.errors <- err:
+						default:
+						}
+						continue
+					}
 
 					select {
-					case ft.events <- event:
+					case s.errors <- err:
 						// nothing to do
 
-					case ft := <-wk.retireTrackerCh:
-						retireTracker(ft)
+					case s := <-wk.retireSinkCh:
+						retireSink(s)
 
 					case <-wk.terminateCh:
 						return
@@ -122,49 +241,125 @@ func (wk *worker) loop() {
 				}
 			}
 
-		case err := <-wk.dirWatcher.Errors:
-			for _, ft := range wk.getTrackers() {
-				if ft.errors == nil {
-					// tracker has been retired, skip it
-					continue
-				}
+		case s := <-wk.retireSinkCh:
+			retireSink(s)
+
+		case <-wk.terminateCh:
+			return
+		}
+	}
+}
 
-				select {
-				case ft.errors <- err:
-					// nothing to do
+// check delivers a notification for the file if it has changed since the
+// previous one. A symlink swap is reported as a single create event for the
+// watched path. It returns false if the worker was told to exit meanwhile.
+// used only by the worker goroutine
+func (wk *worker) check(path string, ft *fileTracker, event fsnotify.Event) bool {
+	change, swap := ft.changed(path, event)
+	if change == nil {
+		return true
+	}
 
-				case ft := <-wk.retireTrackerCh:
-					retireTracker(ft)
+	if swap != nil {
+		if ft.onSwap != nil {
+			ft.onSwap(*swap)
+		}
+		event = fsnotify.Event{Name: path, Op: fsnotify.Create}
+	}
 
-				case <-wk.terminateCh:
-					return
-				}
+	return wk.notify(ft, event, *change)
+}
+
+// notify delivers an event to the sinks of the tracker. Subscriptions whose
+// buffer is full already have a notification pending, and the event is
+// dropped for them. It returns false if the worker was told to exit meanwhile.
+// used only by the worker goroutine
+func (wk *worker) notify(ft *fileTracker, event fsnotify.Event, change Change) bool {
+	for _, s := range wk.sinksOf(ft) {
+		if s.closed {
+			// sink has been retired, skip it
+			continue
+		}
+
+		if !s.primary {
+			select {
+			case s.events <- event:
+			default:
+			}
+			select {
+			case s.changes <- change:
+			default:
 			}
+			continue
+		}
+
+		select {
+		case s.events <- event:
+			// nothing to do
 
-		case ft := <-wk.retireTrackerCh:
-			retireTracker(ft)
+		case s := <-wk.retireSinkCh:
+			retireSink(s)
 
 		case <-wk.terminateCh:
-			return
+			return false
+		}
+	}
+	return true
+}
+
+// schedule records the event as pending for the tracker and (re-)arms its
+// timer, so that a single notification is delivered once the file has been
+// quiet for the configured period, or the maximum delay has been reached.
+// used only by the worker goroutine
+func (wk *worker) schedule(path string, ft *fileTracker, event fsnotify.Event) {
+	now := time.Now()
+	if ft.pending == nil {
+		ft.pendingSince = now
+	}
+	ft.pending = &event
+	ft.generation++
+
+	delay := ft.quiet
+	if ft.maxDelay > 0 {
+		if remaining := ft.pendingSince.Add(ft.maxDelay).Sub(now); remaining < delay {
+			delay = remaining
 		}
 	}
+
+	if ft.timer != nil {
+		ft.timer.Stop()
+	}
+	req := flushRequest{path: path, ft: ft, generation: ft.generation}
+	ft.timer = time.AfterFunc(delay, func() {
+		select {
+		case wk.flushCh <- req:
+		case <-wk.doneCh:
+		}
+	})
 }
 
 // used only by the worker goroutine
-func (wk *worker) drainRetiringTrackers() {
-	// cleanup any trackers that were in the process
+func (wk *worker) drainRetiringSinks() {
+	// cleanup any sinks that were in the process
 	// of being retired, but didn't get processed due
 	// to termination
 	for {
 		select {
-		case ft := <-wk.retireTrackerCh:
-			retireTracker(ft)
+		case s := <-wk.retireSinkCh:
+			retireSink(s)
 		default:
 			return
 		}
 	}
 }
 
+// sinksOf returns the current sinks of the tracker.
+func (wk *worker) sinksOf(ft *fileTracker) []*sink {
+	wk.mu.RLock()
+	defer wk.mu.RUnlock()
+	return ft.sinks
+}
+
 // make a local copy of the set of trackers to avoid contention with callers
 // used only by the worker goroutine
 func (wk *worker) getTrackers() map[string]*fileTracker {
@@ -179,61 +374,221 @@ func (wk *worker) getTrackers() map[string]*fileTracker {
 	return result
 }
 
+// trackersFor returns the trackers that may be affected by the given event.
+// An event naming a watched file only concerns that file. Any other event
+// in the directory may redirect a watched symlink, so symlinked files are
+// checked as well.
+// used only by the worker goroutine
+func (wk *worker) trackersFor(event fsnotify.Event) map[string]*fileTracker {
+	name := filepath.Clean(event.Name)
+
+	wk.mu.RLock()
+	defer wk.mu.RUnlock()
+
+	if ft, ok := wk.watchedFiles[name]; ok {
+		return map[string]*fileTracker{name: ft}
+	}
+
+	result := make(map[string]*fileTracker)
+	for k, v := range wk.watchedFiles {
+		if v.symlink {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// concerns reports whether an event for the named directory entry may affect
+// the file. Besides events for the file itself, this is the case when its
+// symlinks have been redirected, or when the entry is on the path of the
+// resolved target, e.g. a symlink to a file in the same directory.
+// used only by the worker goroutine
+func (ft *fileTracker) concerns(path, name string) bool {
+	name = filepath.Clean(name)
+	if name == path {
+		return true
+	}
+
+	target := resolveSymlinks(path)
+	return target != ft.target || isWithin(target, resolveEntry(name))
+}
+
+// changed describes the change of the file since the previous notification,
+// or returns nil if it hasn't changed. A file changes either because its
+// digest differs or because its symlinks were swapped to another target. In
+// the latter case the swap is returned as well.
+// used only by the worker goroutine
+func (ft *fileTracker) changed(path string, event fsnotify.Event) (*Change, *SymlinkSwap) {
+	ft.symlink = isSymlink(path)
+
+	var swap *SymlinkSwap
+	if target := resolveSymlinks(path); target != ft.target {
+		if ft.symlink && ft.target != "" && target != "" {
+			swap = &SymlinkSwap{
+				Path:      path,
+				OldTarget: ft.target,
+				NewTarget: target,
+			}
+		}
+		ft.target = target
+	}
+
+	start := time.Now()
+	digest := ft.detector.Digest(path)
+	recordHashDuration(path, time.Since(start))
+
+	if swap == nil && !ft.detector.Changed(ft.digest, digest) {
+		recordDuplicate(path)
+		return nil, nil
+	}
+	recordChange(path)
+
+	change := newChange(path, event, ft.exists, ft.digest, digest)
+	ft.digest = digest
+	ft.exists = change.exists()
+	return &change, swap
+}
+
 // used only by the worker goroutine
-func retireTracker(ft *fileTracker) {
-	close(ft.events)
-	close(ft.errors)
-	ft.events = nil
-	ft.errors = nil
+func retireSink(s *sink) {
+	if s.closed {
+		return
+	}
+	close(s.events)
+	close(s.errors)
+	close(s.changes)
+	s.closed = true
 }
 
 func (wk *worker) terminate() {
 	wk.terminateCh <- true
 }
 
-func (wk *worker) addPath(path string) error {
+func (wk *worker) addPath(path string, opts *watchOptions) error {
 	wk.mu.Lock()
+	defer wk.mu.Unlock()
 
-	ft := wk.watchedFiles[path]
-	if ft != nil {
-		wk.mu.Unlock()
+	if ft := wk.watchedFiles[path]; ft != nil && ft.primarySink() != nil {
 		return fmt.Errorf("path %s is already being watched", path)
 	}
 
-	ft = &fileTracker{
-		events: make(chan fsnotify.Event),
-		errors: make(chan error),
-		md5Sum: getMd5Sum(path),
+	wk.attachSink(path, opts, newSink(true, 0))
+	return nil
+}
+
+func (wk *worker) removePath(path string) error {
+	wk.mu.Lock()
+
+	ft := wk.watchedFiles[path]
+	if ft == nil || ft.primarySink() == nil {
+		wk.mu.Unlock()
+		return fmt.Errorf("path %s not found", path)
 	}
 
-	wk.watchedFiles[path] = ft
+	s := ft.primarySink()
+	wk.detachSink(path, ft, s)
 	wk.mu.Unlock()
 
+	wk.retireSinkCh <- s
 	return nil
 }
 
-func (wk *worker) removePath(path string) error {
+// addSubscriber registers a new buffered sink for the path.
+func (wk *worker) addSubscriber(path string, opts *watchOptions) *sink {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+
+	s := newSink(false, opts.bufferSize)
+	wk.attachSink(path, opts, s)
+	return s
+}
+
+// removeSubscriber unregisters a sink created by addSubscriber.
+func (wk *worker) removeSubscriber(path string, s *sink) error {
 	wk.mu.Lock()
 
 	ft := wk.watchedFiles[path]
-	if ft == nil {
+	if ft == nil || !ft.hasSink(s) {
 		wk.mu.Unlock()
-		return fmt.Errorf("path %s not found", path)
+		return fmt.Errorf("subscription for path %s not found", path)
 	}
 
-	delete(wk.watchedFiles, path)
+	wk.detachSink(path, ft, s)
 	wk.mu.Unlock()
 
-	wk.retireTrackerCh <- ft
+	wk.retireSinkCh <- s
+	return nil
+}
+
+// attachSink adds a sink to the tracker of the path, creating the tracker if
+// needed. The options only apply when the tracker is created.
+// must be called with the worker's mutex held
+func (wk *worker) attachSink(path string, opts *watchOptions, s *sink) {
+	ft := wk.watchedFiles[path]
+	if ft == nil {
+		ft = &fileTracker{
+			detector: opts.detector,
+			digest:   opts.detector.Digest(path),
+			exists:   fileExists(path),
+			symlink:  isSymlink(path),
+			target:   resolveSymlinks(path),
+			onSwap:   opts.onSwap,
+			quiet:    opts.quiet,
+			maxDelay: opts.maxDelay,
+		}
+		wk.watchedFiles[path] = ft
+	}
+
+	sinks := make([]*sink, 0, len(ft.sinks)+1)
+	ft.sinks = append(append(sinks, ft.sinks...), s)
+}
+
+// detachSink removes a sink from the tracker of the path. The tracker is
+// dropped along with its last sink.
+// must be called with the worker's mutex held
+func (wk *worker) detachSink(path string, ft *fileTracker, s *sink) {
+	sinks := make([]*sink, 0, len(ft.sinks))
+	for _, other := range ft.sinks {
+		if other != s {
+			sinks = append(sinks, other)
+		}
+	}
+	ft.sinks = sinks
+
+	if len(sinks) == 0 {
+		delete(wk.watchedFiles, path)
+	}
+}
+
+// primarySink returns the sink created by Add, if any.
+// must be called with the worker's mutex held
+func (ft *fileTracker) primarySink() *sink {
+	for _, s := range ft.sinks {
+		if s.primary {
+			return s
+		}
+	}
 	return nil
 }
 
+// must be called with the worker's mutex held
+func (ft *fileTracker) hasSink(s *sink) bool {
+	for _, other := range ft.sinks {
+		if other == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (wk *worker) eventChannel(path string) chan fsnotify.Event {
 	wk.mu.RLock()
 	defer wk.mu.RUnlock()
 
 	if ft := wk.watchedFiles[path]; ft != nil {
-		return ft.events
+		if s := ft.primarySink(); s != nil {
+			return s.events
+		}
 	}
 
 	return nil
@@ -244,22 +599,47 @@ func (wk *worker) errorChannel(path string) chan error {
 	defer wk.mu.RUnlock()
 
 	if ft := wk.watchedFiles[path]; ft != nil {
-		return ft.errors
+		if s := ft.primarySink(); s != nil {
+			return s.errors
+		}
 	}
 
 	return nil
 }
 
-// gets the MD5 of the given file, or nil if there's a problem
-func getMd5Sum(file string) []byte {
-	f, err := os.Open(file)
+// resolveSymlinks returns the path with all symbolic links followed, or an
+// empty string if it can't be resolved.
+func resolveSymlinks(path string) string {
+	target, err := filepath.EvalSymlinks(path)
 	if err != nil {
-		return nil
+		return ""
+	}
+	return target
+}
+
+// resolveEntry returns the path of a directory entry with the symbolic links
+// of its parent directories followed. The entry itself is not followed.
+func resolveEntry(name string) string {
+	dir, file := filepath.Split(name)
+	if resolved := resolveSymlinks(dir); resolved != "" {
+		return filepath.Join(resolved, file)
 	}
-	defer f.Close()
-	r := bufio.NewReader(f)
+	return name
+}
+
+// isWithin reports whether path is the given entry or located beneath it.
+func isWithin(path, entry string) bool {
+	return path != "" && (path == entry || strings.HasPrefix(path, entry+string(filepath.Separator)))
+}
+
+// fileExists reports whether the given path exists, following symbolic links.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
 
-	h := md5.New()
-	_, _ = io.Copy(h, r)
-	return h.Sum(nil)
+// isSymlink reports whether the given path is a symbolic link.
+func isSymlink(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
 }
@@ -110,6 +110,12 @@ var (
 	// vs. reading it's internal state.
 	useJSON atomic.Value
 	logGrpc bool
+	// the sinks of the UDS server and socket outputs, if any
+	activeUDSSink    atomic.Pointer[udsSink]
+	activeSocketSink atomic.Pointer[socketSink]
+	// the syslog and journald outputs, if any
+	activeSyslog   atomic.Pointer[syslogWriter]
+	activeJournald atomic.Pointer[journaldWriter]
 )
 
 func init() {
@@ -135,7 +141,11 @@ func prepZap(options *Options) (zapcore.Core, zapcore.Core, zapcore.WriteSyncer,
 			EncodeDuration: zapcore.SecondsDurationEncoder,
 			EncodeCaller:   zapcore.ShortCallerEncoder,
 		}
-		enc = zapcore.NewJSONEncoder(encCfg)
+		project := options.stackdriverTraceProject
+		if project == "" {
+			project = options.stackdriverTargetProject
+		}
+		enc = newStackdriverEncoder(zapcore.NewJSONEncoder(encCfg), project)
 		useJSON.Store(true)
 	} else {
 		encCfg := defaultEncoderConfig
@@ -252,6 +262,11 @@ func updateScopes(options *Options) error {
 		return err
 	}
 
+	// update the sampling of all scopes
+	if err := processSamplings(allScopes, options.samplings); err != nil {
+		return err
+	}
+
 	// update the caller location setting of all listed scopes
 	sc := strings.Split(options.logCallers, ",")
 	for _, s := range sc {
@@ -321,11 +336,37 @@ func Configure(options *Options) error {
 		return err
 	}
 
-	if err = updateScopes(options); err != nil {
+	closeFns := make([]func() error, 0)
+	// closes the outputs created so far, leaving the active configuration untouched
+	abort := func(err error) error {
+		for _, f := range closeFns {
+			_ = f()
+		}
 		return err
 	}
 
-	closeFns := make([]func() error, 0)
+	// the outputs which may fail to be created come first
+	var syslog *syslogWriter
+	if options.syslogTarget != "" {
+		if syslog, err = newSyslogWriter(options, errSink); err != nil {
+			return err
+		}
+		closeFns = append(closeFns, syslog.close)
+	}
+
+	var journald *journaldWriter
+	if options.teeToJournald {
+		if journald, err = newJournaldWriter(options); err != nil {
+			return abort(err)
+		}
+		closeFns = append(closeFns, journald.close)
+	}
+
+	if err = updateScopes(options); err != nil {
+		return abort(err)
+	}
+
+	setDeduplication(options.dedupWindow)
 
 	if options.teeToStackdriver {
 		var closeFn, captureCloseFn func() error
@@ -337,8 +378,9 @@ func Configure(options *Options) error {
 			options.stackdriverLogName,
 			options.stackdriverResource)
 		if err != nil {
-			return err
+			return abort(err)
 		}
+		closeFns = append(closeFns, closeFn)
 		captureCore, captureCloseFn, err = teeToStackdriver(
 			captureCore,
 			options.stackdriverTargetProject,
@@ -346,15 +388,63 @@ func Configure(options *Options) error {
 			options.stackdriverLogName,
 			options.stackdriverResource)
 		if err != nil {
-			return err
+			return abort(err)
 		}
-		closeFns = append(closeFns, closeFn, captureCloseFn)
+		closeFns = append(closeFns, captureCloseFn)
 	}
 
+	var sink *udsSink
 	if options.teeToUDSServer {
 		// build uds core.
-		core = teeToUDSServer(core, options.udsSocketAddress, options.udsServerPath)
-		captureCore = teeToUDSServer(captureCore, options.udsSocketAddress, options.udsServerPath)
+		sink = newUDSSink(options, errSink)
+		core = teeToSink(core, sink)
+		captureCore = teeToSink(captureCore, sink)
+		closeFns = append(closeFns, sink.close)
+	}
+
+	var socketSink *socketSink
+	if options.teeToSocket {
+		socketSink = newSocketSink(options, errSink)
+		core = teeToSink(core, socketSink)
+		captureCore = teeToSink(captureCore, socketSink)
+		closeFns = append(closeFns, socketSink.close)
+	}
+
+	// the scope handlers, and the entries captured from zap, are written to syslog and journald
+	if syslog != nil {
+		captureCore = teeToEntryWriter(captureCore, syslog.writeEntry)
+		setOutputHandler(syslogHandlerName, syslog.handle)
+	} else {
+		setOutputHandler(syslogHandlerName, nil)
+	}
+	if journald != nil {
+		captureCore = teeToEntryWriter(captureCore, journald.writeEntry)
+		setOutputHandler(journaldHandlerName, journald.handle)
+	} else {
+		setOutputHandler(journaldHandlerName, nil)
+	}
+
+	// the outputs of the previous configuration are flushed, and replaced
+	if prev := activeUDSSink.Swap(sink); prev != nil {
+		_ = prev.close()
+	}
+	if prev := activeSocketSink.Swap(socketSink); prev != nil {
+		_ = prev.close()
+	}
+	if prev := activeSyslog.Swap(syslog); prev != nil {
+		_ = prev.close()
+	}
+	if prev := activeJournald.Swap(journald); prev != nil {
+		_ = prev.close()
+	}
+
+	if options.redact {
+		r := newRedactor(options.redactKeys, options.redactPatterns)
+		redaction.Store(r)
+		core = newRedactingCore(core, r)
+		captureCore = newRedactingCore(captureCore, r)
+	} else {
+		redaction.Store(nil)
 	}
 
 	pt := patchTable{
@@ -425,10 +515,12 @@ func Configure(options *Options) error {
 // Sync flushes any buffered log entries.
 // Processes should normally take care to call Sync before exiting.
 func Sync() error {
+	flushDeduplication()
 	return funcs.Load().(patchTable).sync()
 }
 
 // Close implements io.Closer.
 func Close() error {
+	flushDeduplication()
 	return funcs.Load().(patchTable).close()
 }
@@ -0,0 +1,104 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+)
+
+type scopeContextKey struct{}
+
+type labelsContextKey struct{}
+
+// WithContext returns a copy of ctx carrying scope, to be retrieved with FromContext.
+func WithContext(ctx context.Context, scope *Scope) context.Context {
+	return context.WithValue(ctx, scopeContextKey{}, scope)
+}
+
+// WithContextLabels returns a copy of ctx carrying request-scoped labels, in addition to those already carried by
+// ctx. The labels are given either as Field values or as alternating keys and values. They are added to the output
+// of the *Ctx functions, and to the scope returned by FromContext.
+//
+//	ctx = log.WithContextLabels(ctx, "requestID", id, log.String("tenant", tenant))
+//	...
+//	scope.InfoCtx(ctx, "Hello")  // <time>   info   MyScope   Hello  requestID=1234 tenant=foo
+func WithContextLabels(ctx context.Context, kvlist ...any) context.Context {
+	prev := contextLabels(ctx)
+	labels := make([]Field, 0, len(prev)+len(kvlist))
+	labels = append(append(labels, prev...), toFields(kvlist)...)
+	return context.WithValue(ctx, labelsContextKey{}, labels)
+}
+
+// FromContext returns the scope carried by ctx, or the default scope if there is none, with the labels carried by ctx
+// added to it.
+func FromContext(ctx context.Context) *Scope {
+	s, ok := ctx.Value(scopeContextKey{}).(*Scope)
+	if !ok {
+		s = defaultScope
+	}
+
+	labels := contextLabels(ctx)
+	if len(labels) == 0 {
+		return s
+	}
+
+	kvlist := make([]any, 0, 2*len(labels))
+	for _, f := range labels {
+		keys, values := fieldValues(f)
+		for _, k := range keys {
+			kvlist = append(kvlist, k, values[k])
+		}
+	}
+	return s.WithLabels(kvlist...)
+}
+
+// contextLabels returns the labels carried by ctx.
+func contextLabels(ctx context.Context) []Field {
+	labels, _ := ctx.Value(labelsContextKey{}).([]Field)
+	return labels
+}
+
+// ErrorCtx outputs a message at error level, with the span and the labels carried by ctx.
+func (s *Scope) ErrorCtx(ctx context.Context, args ...any) {
+	if s.GetOutputLevel() >= ErrorLevel {
+		ie, firstIdx := getErrorStruct(args)
+		s.callHandlers(ErrorLevel, s, ie, fmt.Sprint(args[firstIdx:]...), contextFields(ctx))
+	}
+}
+
+// WarnCtx outputs a message at warn level, with the span and the labels carried by ctx.
+func (s *Scope) WarnCtx(ctx context.Context, args ...any) {
+	if s.GetOutputLevel() >= WarnLevel {
+		ie, firstIdx := getErrorStruct(args)
+		s.callHandlers(WarnLevel, s, ie, fmt.Sprint(args[firstIdx:]...), contextFields(ctx))
+	}
+}
+
+// InfoCtx outputs a message at info level, with the span and the labels carried by ctx.
+func (s *Scope) InfoCtx(ctx context.Context, args ...any) {
+	if s.GetOutputLevel() >= InfoLevel {
+		ie, firstIdx := getErrorStruct(args)
+		s.callHandlers(InfoLevel, s, ie, fmt.Sprint(args[firstIdx:]...), contextFields(ctx))
+	}
+}
+
+// DebugCtx outputs a message at debug level, with the span and the labels carried by ctx.
+func (s *Scope) DebugCtx(ctx context.Context, args ...any) {
+	if s.GetOutputLevel() >= DebugLevel {
+		ie, firstIdx := getErrorStruct(args)
+		s.callHandlers(DebugLevel, s, ie, fmt.Sprint(args[firstIdx:]...), contextFields(ctx))
+	}
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"khetao.com/pkg/structured"
+)
+
+func TestContext(t *testing.T) {
+	s := RegisterScope("TestContext", "Desc", 0)
+	s.SetOutputLevel(DebugLevel)
+
+	ctx := WithContext(context.Background(), s)
+	ctx = WithContextLabels(ctx, "requestID", "1234")
+	ctx = WithContextLabels(ctx, String("tenant", "foo"))
+
+	if got := FromContext(context.Background()); got != defaultScope {
+		t.Fatalf("FromContext() got %v, expected the default scope", got.Name())
+	}
+
+	lines := runTest(t, func() {
+		s.DebugCtx(ctx, "Hello")
+		s.InfoCtx(ctx, "Hello")
+		s.WarnCtx(context.Background(), "Hello")
+		s.ErrorCtx(ctx, &structured.Error{MoreInfo: "MoreInfo"}, "Hello")
+		FromContext(ctx).Info("Hello")
+	})
+
+	mustRegexMatchString(t, lines[0], `debug	TestContext	Hello	requestID=1234 tenant=foo$`)
+	mustRegexMatchString(t, lines[1], `info	TestContext	Hello	requestID=1234 tenant=foo$`)
+	mustRegexMatchString(t, lines[2], `warn	TestContext	Hello$`)
+	mustRegexMatchString(t, lines[3], `error	TestContext	Hello	moreInfo=MoreInfo requestID=1234 tenant=foo$`)
+	mustRegexMatchString(t, lines[4], `info	TestContext	Hello	requestID=1234 tenant=foo$`)
+}
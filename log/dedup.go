@@ -0,0 +1,143 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"khetao.com/pkg/structured"
+)
+
+// the deduplication stage, nil unless enabled with Options.WithDeduplication
+var dedup atomic.Pointer[deduper]
+
+// dedupEntry is a message which was output, along with the number of identical messages suppressed since.
+type dedupEntry struct {
+	scope    *Scope
+	level    Level
+	ie       *structured.Error
+	msg      string
+	fields   []Field
+	repeated int
+	timer    *time.Timer
+}
+
+// deduper collapses identical messages, that is messages of the same scope, level, text and labels, logged within a
+// window: the first one is output, and the number of the others is reported in a summary line when the window closes.
+type deduper struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{
+		window:  window,
+		entries: make(map[string]*dedupEntry),
+	}
+}
+
+// allow returns whether a message should be output, or is a repetition of a message output within the window.
+func (d *deduper) allow(s *Scope, level Level, ie *structured.Error, msg string, fields []Field) bool {
+	key := dedupKey(s, level, ie, msg, fields)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e, ok := d.entries[key]; ok {
+		e.repeated++
+		return false
+	}
+
+	e := &dedupEntry{scope: s, level: level, ie: ie, msg: msg, fields: fields}
+	e.timer = time.AfterFunc(d.window, func() { d.expire(key, e) })
+	d.entries[key] = e
+	return true
+}
+
+// expire closes the window of an entry.
+func (d *deduper) expire(key string, e *dedupEntry) {
+	d.mu.Lock()
+	if d.entries[key] == e {
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+
+	e.report()
+}
+
+// flush closes the windows of all entries.
+func (d *deduper) flush() {
+	d.mu.Lock()
+	entries := d.entries
+	d.entries = make(map[string]*dedupEntry)
+	d.mu.Unlock()
+
+	for _, e := range entries {
+		if e.timer.Stop() {
+			e.report()
+		}
+	}
+}
+
+// report outputs the summary of the entry, if any message was suppressed.
+func (e *dedupEntry) report() {
+	if e.repeated > 0 {
+		e.scope.dispatch(e.level, e.scope, e.ie, fmt.Sprintf("%s (repeated %d times)", e.msg, e.repeated), e.fields)
+	}
+}
+
+// dedupKey identifies the messages which are identical.
+func dedupKey(s *Scope, level Level, ie *structured.Error, msg string, fields []Field) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s\x00%d\x00%s", s.name, level, msg)
+	if ie != nil {
+		fmt.Fprintf(sb, "\x00%+v", *ie)
+	}
+	for _, k := range s.labelKeys {
+		fmt.Fprintf(sb, "\x00%s=%v", k, s.labels[k])
+	}
+	for _, f := range fields {
+		keys, values := fieldValues(f)
+		for _, k := range keys {
+			fmt.Fprintf(sb, "\x00%s=%v", k, values[k])
+		}
+	}
+	return sb.String()
+}
+
+// setDeduplication enables the deduplication of messages within window, or disables it if window is 0. The summaries
+// pending in the previous stage are output.
+func setDeduplication(window time.Duration) {
+	var d *deduper
+	if window > 0 {
+		d = newDeduper(window)
+	}
+	if prev := dedup.Swap(d); prev != nil {
+		prev.flush()
+	}
+}
+
+// flushDeduplication outputs the pending summaries.
+func flushDeduplication() {
+	if d := dedup.Load(); d != nil {
+		d.flush()
+	}
+}
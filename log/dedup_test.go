@@ -0,0 +1,83 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeduplication(t *testing.T) {
+	s := RegisterScope("TestDeduplication", "Desc", 0)
+
+	lines, err := captureStdout(func() {
+		if err := Configure(DefaultOptions().WithDeduplication(time.Hour)); err != nil {
+			t.Fatalf("Configure() failed: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			s.Error("Boom")
+			s.WithLabels("foo", "bar").Error("Boom")
+			s.Errorw("Boom", "foo", "baz")
+			s.Warn("Boom")
+		}
+		s.Info("Once")
+
+		// Sync reports the pending summaries
+		_ = Sync()
+		s.Error("Boom")
+		_ = Configure(DefaultOptions())
+		_ = Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	want := []string{
+		`error	TestDeduplication	Boom$`,
+		`error	TestDeduplication	Boom	foo=bar$`,
+		`error	TestDeduplication	Boom	foo=baz$`,
+		`warn	TestDeduplication	Boom$`,
+		`info	TestDeduplication	Once$`,
+	}
+	if len(lines) != 10+1 {
+		t.Fatalf("Got %d lines, expected 10: %v", len(lines), lines)
+	}
+	for i, w := range want {
+		mustRegexMatchString(t, lines[i], w)
+	}
+
+	summaries := map[string]bool{}
+	for _, l := range lines[5:9] {
+		summaries[l[len("2006-01-02T15:04:05.000000Z	"):]] = true
+	}
+	for _, w := range []string{
+		"error	TestDeduplication	Boom (repeated 2 times)",
+		"error	TestDeduplication	Boom (repeated 2 times)	foo=bar",
+		"error	TestDeduplication	Boom (repeated 2 times)	foo=baz",
+		"warn	TestDeduplication	Boom (repeated 2 times)",
+	} {
+		if !summaries[w] {
+			t.Errorf("Missing summary %q in %v", w, lines[5:9])
+		}
+	}
+	mustRegexMatchString(t, lines[9], `error	TestDeduplication	Boom$`)
+}
+
+func TestDeduplicationWindow(t *testing.T) {
+	s := RegisterScope("TestDeduplicationWindow", "Desc", 0)
+
+	lines, err := captureStdout(func() {
+		_ = Configure(DefaultOptions().WithDeduplication(50 * time.Millisecond))
+		s.Error("Boom")
+		s.Error("Boom")
+		time.Sleep(200 * time.Millisecond)
+		s.Error("Boom")
+		_ = Configure(DefaultOptions())
+		_ = Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	mustRegexMatchString(t, lines[0], `Boom$`)
+	mustRegexMatchString(t, lines[1], `Boom \(repeated 1 times\)$`)
+	mustRegexMatchString(t, lines[2], `Boom$`)
+}
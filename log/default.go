@@ -47,6 +47,12 @@ func Errorf(args ...any) {
 	defaultScope.Errorf(args...)
 }
 
+// Errorw outputs a message at error level, with fields given either as Field values or as alternating keys and
+// values.
+func Errorw(msg string, kvlist ...any) {
+	defaultScope.Errorw(msg, kvlist...)
+}
+
 // ErrorEnabled returns whether output of messages using this scope is currently enabled for error-level output.
 func ErrorEnabled() bool {
 	return defaultScope.ErrorEnabled()
@@ -67,6 +73,12 @@ func Warnf(args ...any) {
 	defaultScope.Warnf(args...)
 }
 
+// Warnw outputs a message at warn level, with fields given either as Field values or as alternating keys and
+// values.
+func Warnw(msg string, kvlist ...any) {
+	defaultScope.Warnw(msg, kvlist...)
+}
+
 // WarnEnabled returns whether output of messages using this scope is currently enabled for warn-level output.
 func WarnEnabled() bool {
 	return defaultScope.WarnEnabled()
@@ -82,6 +94,12 @@ func Infof(args ...any) {
 	defaultScope.Infof(args...)
 }
 
+// Infow outputs a message at info level, with fields given either as Field values or as alternating keys and
+// values.
+func Infow(msg string, kvlist ...any) {
+	defaultScope.Infow(msg, kvlist...)
+}
+
 // InfoEnabled returns whether output of messages using this scope is currently enabled for info-level output.
 func InfoEnabled() bool {
 	return defaultScope.InfoEnabled()
@@ -97,6 +115,12 @@ func Debugf(args ...any) {
 	defaultScope.Debugf(args...)
 }
 
+// Debugw outputs a message at debug level, with fields given either as Field values or as alternating keys and
+// values.
+func Debugw(msg string, kvlist ...any) {
+	defaultScope.Debugw(msg, kvlist...)
+}
+
 // DebugEnabled returns whether output of messages using this scope is currently enabled for debug-level output.
 func DebugEnabled() bool {
 	return defaultScope.DebugEnabled()
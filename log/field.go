@@ -0,0 +1,108 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Field is a typed key-value pair attached to a single message, see Scope.Infow. Fields are emitted as is in JSON
+// mode, and as key=value pairs in console mode.
+type Field = zapcore.Field
+
+// String returns a field with a string value.
+func String(key, value string) Field {
+	return zap.String(key, value)
+}
+
+// Int returns a field with an int value.
+func Int(key string, value int) Field {
+	return zap.Int(key, value)
+}
+
+// Err returns a field for err under the "error" key. A nil err adds nothing.
+func Err(err error) Field {
+	return zap.Error(err)
+}
+
+// Duration returns a field with a time.Duration value.
+func Duration(key string, value time.Duration) Field {
+	return zap.Duration(key, value)
+}
+
+// Any returns a field with a value of any type.
+func Any(key string, value any) Field {
+	return zap.Any(key, value)
+}
+
+// toFields converts the arguments of the *w functions, which are either Field values or alternating keys and values,
+// to fields. Malformed arguments are reported in a field, as done by WithLabels.
+func toFields(kvlist []any) []Field {
+	if len(kvlist) == 0 {
+		return nil
+	}
+
+	fields := make([]Field, 0, len(kvlist))
+	for i := 0; i < len(kvlist); i++ {
+		if f, ok := kvlist[i].(Field); ok {
+			fields = append(fields, f)
+			continue
+		}
+
+		key, ok := kvlist[i].(string)
+		if !ok {
+			return append(fields, String("fields error", fmt.Sprintf("field name %v must be a string, got %T", kvlist[i], kvlist[i])))
+		}
+		if i+1 == len(kvlist) {
+			return append(fields, String("fields error", fmt.Sprintf("missing value for field %s", key)))
+		}
+		fields = append(fields, Any(key, kvlist[i+1]))
+		i++
+	}
+	return fields
+}
+
+// fieldValues returns the keys and values a field encodes to, sorted by key.
+func fieldValues(f Field) ([]string, map[string]any) {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, enc.Fields
+}
+
+// appendFieldStrings appends the fields to sb as space separated key=value strings.
+func appendFieldStrings(sb *strings.Builder, fields []Field, space bool) {
+	for _, f := range fields {
+		keys, values := fieldValues(f)
+		for _, k := range keys {
+			if space {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(fmt.Sprintf("%s=%v", k, values[k]))
+			space = true
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"khetao.com/pkg/structured"
+)
+
+// Entry is a message passed to the handlers registered with RegisterHandler.
+type Entry struct {
+	Time    time.Time
+	Scope   string
+	Level   Level
+	Message string
+
+	// Labels holds the labels of the scope, and the fields of the message.
+	Labels map[string]any
+
+	// Fields holds the fields passed to the *w and *Ctx functions.
+	Fields []Field
+
+	// Error is the structured error passed as the first argument, if any.
+	Error *structured.Error
+}
+
+// handlerIDs identifies the registrations of handlers.
+var handlerIDs atomic.Uint64
+
+// Handler is called for every message output by any scope.
+type Handler func(e Entry)
+
+// HandlerOption configures a handler registered with RegisterHandler.
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	level Level
+}
+
+// WithHandlerLevel restricts a handler to the messages of the given level or more severe. By default, a handler gets
+// the messages of all levels. In any case, it only gets the messages enabled by the output level of their scope.
+func WithHandlerLevel(level Level) HandlerOption {
+	return func(o *handlerOptions) {
+		o.level = level
+	}
+}
+
+// RegisterHandler registers a handler called for the messages of all scopes, along with the default output, e.g. to
+// count errors or record messages in tests. Handlers are called before the default output, so that they get fatal
+// messages before the process exits. Registering a handler with the name of an existing one replaces it. The
+// returned function unregisters the handler.
+func RegisterHandler(name string, h Handler, opts ...HandlerOption) func() {
+	o := &handlerOptions{level: DebugLevel}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	reg := handlerRegistration{
+		name: name,
+		id:   handlerIDs.Add(1),
+		handle: func(level Level, scope *Scope, ie *structured.Error, msg string, fields []Field) {
+			if level > o.level {
+				return
+			}
+			h(newEntry(level, scope, ie, msg, fields))
+		},
+	}
+
+	defaultHandlersMu.Lock()
+	defer defaultHandlersMu.Unlock()
+
+	// inserted before the default output, which exits the process on fatal messages, and after the handlers
+	// registered before
+	handlers := make([]handlerRegistration, 0, len(defaultHandlers)+1)
+	inserted := false
+	for _, other := range defaultHandlers {
+		if other.name == name && other.id != 0 {
+			continue
+		}
+		if !inserted && other.id == 0 && other.name == "" {
+			handlers = append(handlers, reg)
+			inserted = true
+		}
+		handlers = append(handlers, other)
+	}
+	if !inserted {
+		handlers = append(handlers, reg)
+	}
+	defaultHandlers = handlers
+
+	return func() {
+		unregisterHandler(name, reg.id)
+	}
+}
+
+// UnregisterHandler unregisters the handler registered with the given name. It returns false if there is none.
+func UnregisterHandler(name string) bool {
+	return unregisterHandler(name, 0)
+}
+
+// unregisterHandler unregisters the named handler, provided it has the given id if not 0, so that a handler which
+// has been replaced isn't unregistered by its predecessor.
+func unregisterHandler(name string, id uint64) bool {
+	defaultHandlersMu.Lock()
+	defer defaultHandlersMu.Unlock()
+
+	for i, h := range defaultHandlers {
+		if h.id == 0 || h.name != name {
+			continue
+		}
+		if id != 0 && h.id != id {
+			return false
+		}
+
+		handlers := make([]handlerRegistration, 0, len(defaultHandlers)-1)
+		defaultHandlers = append(append(handlers, defaultHandlers[:i]...), defaultHandlers[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// newEntry describes a message for handlers.
+func newEntry(level Level, scope *Scope, ie *structured.Error, msg string, fields []Field) Entry {
+	if r := redaction.Load(); r != nil {
+		scope = r.labels(scope)
+		ie = r.error(ie)
+		msg = r.string(msg)
+		fields = r.fields(fields)
+	}
+
+	labels := make(map[string]any, len(scope.labelKeys)+len(fields))
+	for _, k := range scope.labelKeys {
+		labels[k] = scope.labels[k]
+	}
+	for _, f := range fields {
+		keys, values := fieldValues(f)
+		for _, k := range keys {
+			labels[k] = values[k]
+		}
+	}
+
+	return Entry{
+		Time:    scope.now(),
+		Scope:   scope.name,
+		Level:   level,
+		Message: msg,
+		Labels:  labels,
+		Fields:  fields,
+		Error:   ie,
+	}
+}
+
+// reportWriteError reports the failure of an output to the error output, if err isn't nil.
+func reportWriteError(err error) {
+	if err == nil {
+		return
+	}
+	pt := funcs.Load().(patchTable)
+	_, _ = fmt.Fprintf(pt.errorSink, "%v log write error: %v\n", time.Now(), err)
+	_ = pt.errorSink.Sync()
+}
+
+// entryCore passes the entries logged through zap, rather than a scope, to an output installed with
+// setOutputHandler. Their fields are passed as labels.
+type entryCore struct {
+	minimumLevel zapcore.Level
+	write        func(e Entry, caller zapcore.EntryCaller) error
+	fields       []Field
+}
+
+// teeToEntryWriter returns a core writing to baseCore, and to write from the minimum level enabled by baseCore.
+func teeToEntryWriter(baseCore zapcore.Core, write func(e Entry, caller zapcore.EntryCaller) error) zapcore.Core {
+	ec := &entryCore{write: write}
+	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
+		if baseCore.Enabled(l) {
+			ec.minimumLevel = l
+			break
+		}
+	}
+	return zapcore.NewTee(baseCore, ec)
+}
+
+func (c *entryCore) Enabled(level zapcore.Level) bool {
+	return level >= c.minimumLevel
+}
+
+func (c *entryCore) With(fields []zapcore.Field) zapcore.Core {
+	return &entryCore{
+		minimumLevel: c.minimumLevel,
+		write:        c.write,
+		fields:       append(append([]Field(nil), c.fields...), fields...),
+	}
+}
+
+func (c *entryCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *entryCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	all := append(append([]Field(nil), c.fields...), fields...)
+	labels := make(map[string]any, len(all))
+	for _, f := range all {
+		keys, values := fieldValues(f)
+		for _, k := range keys {
+			labels[k] = values[k]
+		}
+	}
+
+	// panics are more severe than errors
+	level, ok := toLevel[entry.Level]
+	if !ok {
+		level = FatalLevel
+	}
+
+	scope := entry.LoggerName
+	if scope == "" {
+		scope = DefaultScopeName
+	}
+	return c.write(Entry{
+		Time:    entry.Time,
+		Scope:   scope,
+		Level:   level,
+		Message: entry.Message,
+		Labels:  labels,
+		Fields:  all,
+	}, entry.Caller)
+}
+
+func (c *entryCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"errors"
+	"testing"
+
+	"khetao.com/pkg/structured"
+)
+
+func TestRegisterHandler(t *testing.T) {
+	s := RegisterScope("TestRegisterHandler", "Desc", 0)
+	s.SetOutputLevel(DebugLevel)
+
+	var all, errs []Entry
+	unregisterAll := RegisterHandler("all", func(e Entry) { all = append(all, e) })
+	defer unregisterAll()
+	RegisterHandler("errors", func(e Entry) { errs = append(errs, e) }, WithHandlerLevel(ErrorLevel))
+	defer UnregisterHandler("errors")
+
+	lines := runTest(t, func() {
+		s.Debug("Hello")
+		s.WithLabels("foo", "bar").Errorw("Boom", Err(errors.New("boom")))
+		s.Warn(&structured.Error{MoreInfo: "MoreInfo"}, "Warning")
+	})
+	if len(lines) != 3 {
+		t.Fatalf("Got %d lines, expected the default output to be kept: %v", len(lines), lines)
+	}
+
+	if len(all) != 3 || len(errs) != 1 {
+		t.Fatalf("Got %d and %d entries, expected 3 and 1", len(all), len(errs))
+	}
+	e := errs[0]
+	if e.Scope != "TestRegisterHandler" || e.Level != ErrorLevel || e.Message != "Boom" {
+		t.Errorf("Got %+v, expected an error of TestRegisterHandler", e)
+	}
+	if e.Labels["foo"] != "bar" || e.Labels["error"] != "boom" || len(e.Fields) != 1 {
+		t.Errorf("Got labels %v and fields %v", e.Labels, e.Fields)
+	}
+	if all[2].Error == nil || all[2].Error.MoreInfo != "MoreInfo" {
+		t.Errorf("Got error %v, expected the structured error", all[2].Error)
+	}
+
+	// replacing a handler keeps it registered when the previous one is unregistered
+	var replaced []Entry
+	RegisterHandler("all", func(e Entry) { replaced = append(replaced, e) })
+	unregisterAll()
+	runTest(t, func() { s.Info("Hello") })
+	if len(all) != 3 || len(replaced) != 1 {
+		t.Errorf("Got %d and %d entries, expected the replaced handler to be called", len(all), len(replaced))
+	}
+
+	if !UnregisterHandler("all") || UnregisterHandler("all") {
+		t.Error("UnregisterHandler() should succeed once")
+	}
+	runTest(t, func() { s.Info("Hello") })
+	if len(replaced) != 1 {
+		t.Errorf("Got %d entries, expected the handler to be unregistered", len(replaced))
+	}
+}
+
+func TestRegisterHandlerFromHandler(t *testing.T) {
+	s := RegisterScope("TestRegisterHandlerFromHandler", "Desc", 0)
+
+	// a handler unregistering itself, and registering another one, doesn't deadlock
+	var calls, nested int
+	RegisterHandler("once", func(Entry) {
+		calls++
+		UnregisterHandler("once")
+		RegisterHandler("nested", func(Entry) { nested++ })
+	})
+	defer UnregisterHandler("nested")
+
+	runTest(t, func() {
+		s.Info("Hello")
+		s.Info("Hello")
+	})
+	if calls != 1 || nested != 1 {
+		t.Errorf("Got %d and %d calls, expected 1 and 1", calls, nested)
+	}
+}
+
+func TestRegisterHandlerFatal(t *testing.T) {
+	s := RegisterScope("TestRegisterHandlerFatal", "Desc", 0)
+
+	var entries []Entry
+	defer RegisterHandler("fatal", func(e Entry) { entries = append(entries, e) })()
+
+	// the handler got the message by the time the process exits
+	handled := -1
+	runTest(t, func() {
+		pt := funcs.Load().(patchTable)
+		pt.exitProcess = func(_ int) {
+			handled = len(entries)
+		}
+		funcs.Store(pt)
+
+		s.Fatal("Boom")
+	})
+	if handled != 1 || entries[0].Level != FatalLevel || entries[0].Message != "Boom" {
+		t.Errorf("Got %d entries when exiting, expected the fatal message", handled)
+	}
+}
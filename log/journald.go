@@ -0,0 +1,229 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"go.uber.org/zap/zapcore"
+
+	"khetao.com/pkg/structured"
+)
+
+const (
+	// journaldHandlerName is the name of the scope handler writing to journald.
+	journaldHandlerName = "journald"
+
+	// DefaultJournaldSocket is the native socket of journald.
+	DefaultJournaldSocket = "/run/systemd/journal/socket"
+)
+
+// journaldReservedFields are the fields written by journaldWriter, and the other fields interpreted by journald, which
+// labels can't override.
+var journaldReservedFields = map[string]bool{
+	"MESSAGE":            true,
+	"MESSAGE_ID":         true,
+	"PRIORITY":           true,
+	"CODE_FILE":          true,
+	"CODE_LINE":          true,
+	"CODE_FUNC":          true,
+	"ERRNO":              true,
+	"INVOCATION_ID":      true,
+	"USER_INVOCATION_ID": true,
+	"SYSLOG_FACILITY":    true,
+	"SYSLOG_IDENTIFIER":  true,
+	"SYSLOG_PID":         true,
+	"SYSLOG_TIMESTAMP":   true,
+	"SYSLOG_RAW":         true,
+	"DOCUMENTATION":      true,
+	"TID":                true,
+	"UNIT":               true,
+	"USER_UNIT":          true,
+	"LOG_SCOPE":          true,
+	"ERROR":              true,
+	"MORE_INFO":          true,
+	"IMPACT":             true,
+	"ACTION":             true,
+	"LIKELY_CAUSE":       true,
+}
+
+// journaldWriter writes messages to journald, with its native protocol. A message is sent as a datagram of fields:
+// MESSAGE, PRIORITY, SYSLOG_IDENTIFIER, the caller in CODE_FILE, CODE_LINE and CODE_FUNC, the scope in LOG_SCOPE,
+// the structured error in ERROR, MORE_INFO, IMPACT, ACTION and LIKELY_CAUSE, and one field per label, named after
+// the label in upper case, and prefixed with LABEL_ if it clashes with the fields above or those interpreted by
+// journald.
+//
+// Messages too large for a datagram are passed in a temporary file, where supported.
+type journaldWriter struct {
+	socket     string
+	identifier string
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+func newJournaldWriter(options *Options) (*journaldWriter, error) {
+	socket := options.journaldSocket
+	if socket == "" {
+		socket = DefaultJournaldSocket
+	}
+
+	identifier := options.journaldIdentifier
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald %v: %v", socket, err)
+	}
+
+	return &journaldWriter{
+		socket:     socket,
+		identifier: identifier,
+		conn:       conn,
+	}, nil
+}
+
+// handle is the scope handler writing to journald.
+func (w *journaldWriter) handle(level Level, scope *Scope, ie *structured.Error, msg string, fields []Field) {
+	// called by callHandlers, one frame above emit
+	caller := scope.caller(scope.callerSkip + callerSkipOffset - 1)
+	if fn := runtime.FuncForPC(caller.PC); fn != nil && caller.Function == "" {
+		caller.Function = fn.Name()
+	}
+	reportWriteError(w.writeEntry(newEntry(level, scope, ie, msg, fields), caller))
+}
+
+// writeEntry writes e, logged by caller if defined.
+func (w *journaldWriter) writeEntry(e Entry, caller zapcore.EntryCaller) error {
+	var b bytes.Buffer
+	appendJournaldField(&b, "MESSAGE", e.Message)
+	appendJournaldField(&b, "PRIORITY", strconv.Itoa(levelToSyslogSeverity[e.Level]))
+	appendJournaldField(&b, "SYSLOG_IDENTIFIER", w.identifier)
+	appendJournaldField(&b, "LOG_SCOPE", e.Scope)
+
+	if caller.Defined {
+		appendJournaldField(&b, "CODE_FILE", caller.File)
+		appendJournaldField(&b, "CODE_LINE", strconv.Itoa(caller.Line))
+		appendJournaldField(&b, "CODE_FUNC", caller.Function)
+	}
+
+	if ie := e.Error; ie != nil {
+		appendJournaldField(&b, "ERROR", toErrString(ie.Err))
+		appendJournaldField(&b, "MORE_INFO", ie.MoreInfo)
+		appendJournaldField(&b, "IMPACT", ie.Impact)
+		appendJournaldField(&b, "ACTION", ie.Action)
+		appendJournaldField(&b, "LIKELY_CAUSE", ie.LikelyCause)
+	}
+
+	keys := make([]string, 0, len(e.Labels))
+	for k := range e.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name := journaldFieldName(k); name != "" {
+			appendJournaldField(&b, name, fmt.Sprint(e.Labels[k]))
+		}
+	}
+
+	return w.write(b.Bytes())
+}
+
+// write sends msg as a datagram, or in a temporary file if it is too large.
+func (w *journaldWriter) write(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return fmt.Errorf("failed to write to journald %v: closed", w.socket)
+	}
+
+	_, err := w.conn.Write(msg)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = sendJournaldFile(w.conn, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to journald %v: %v", w.socket, err)
+	}
+	return nil
+}
+
+// appendJournaldField appends a field to b. Values spanning several lines are prefixed with their size, as required
+// by the native protocol. If value is empty, it does nothing.
+func appendJournaldField(b *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journaldFieldName returns the field name for a label: upper case letters, digits and underscores, not starting
+// with an underscore, which is reserved to trusted fields, or a digit, and at most 64 characters. Reserved field names
+// are prefixed with LABEL_. It returns an empty string if there is none.
+func journaldFieldName(label string) string {
+	n := []byte(strings.ToUpper(label))
+	for i, c := range n {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			n[i] = '_'
+		}
+	}
+
+	name := strings.TrimLeft(string(n), "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if journaldReservedFields[name] {
+		name = "LABEL_" + name
+	}
+	return name
+}
+
+func (w *journaldWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"khetao.com/pkg/structured"
+)
+
+// listenJournald listens on a datagram socket standing in for journald, and configures the journald output to
+// write to it.
+func listenJournald(t *testing.T) *net.UnixConn {
+	socketPath := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	if err := Configure(DefaultOptions().WithJournald(socketPath, "myapp")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(DefaultOptions()) })
+	return conn
+}
+
+// receiveJournald reads a datagram from conn, and parses its fields.
+func receiveJournald(t *testing.T, conn *net.UnixConn) map[string]string {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to receive journald message: %v", err)
+	}
+
+	fields, err := parseJournald(buf[:n])
+	if err != nil {
+		t.Fatalf("invalid journald message %q: %v", buf[:n], err)
+	}
+	return fields
+}
+
+// parseJournald parses the fields of a message of the native protocol.
+func parseJournald(b []byte) (map[string]string, error) {
+	fields := map[string]string{}
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		if i < 0 {
+			return nil, errors.New("missing end of field")
+		}
+
+		name := string(b[:i])
+		if b[i] == '=' {
+			end := bytes.IndexByte(b[i:], '\n')
+			if end < 0 {
+				return nil, errors.New("missing end of value")
+			}
+			fields[name] = string(b[i+1 : i+end])
+			b = b[i+end+1:]
+			continue
+		}
+
+		b = b[i+1:]
+		if len(b) < 8 {
+			return nil, errors.New("missing size of value")
+		}
+		size := binary.LittleEndian.Uint64(b)
+		b = b[8:]
+		if uint64(len(b)) < size+1 || b[size] != '\n' {
+			return nil, errors.New("invalid size of value")
+		}
+		fields[name] = string(b[:size])
+		b = b[size+1:]
+	}
+	return fields, nil
+}
+
+func TestJournald(t *testing.T) {
+	conn := listenJournald(t)
+	s := RegisterScope("journaldscope", "", 0)
+
+	s.WithLabels("request-id", "abc", "_trusted", "x", "priority", "0").Infow("hello\nworld", "count", 3)
+	got := receiveJournald(t, conn)
+
+	if !strings.HasSuffix(got["CODE_FILE"], "log/journald_test.go") || got["CODE_LINE"] == "" ||
+		!strings.HasSuffix(got["CODE_FUNC"], "TestJournald") {
+		t.Errorf("got caller %v:%v %v, want the test", got["CODE_FILE"], got["CODE_LINE"], got["CODE_FUNC"])
+	}
+	delete(got, "CODE_FILE")
+	delete(got, "CODE_LINE")
+	delete(got, "CODE_FUNC")
+
+	want := map[string]string{
+		"MESSAGE":           "hello\nworld",
+		"PRIORITY":          "6",
+		"SYSLOG_IDENTIFIER": "myapp",
+		"LOG_SCOPE":         "journaldscope",
+		"REQUEST_ID":        "abc",
+		"TRUSTED":           "x",
+		"LABEL_PRIORITY":    "0",
+		"COUNT":             "3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got fields %v, want %v", got, want)
+	}
+
+	s.Error(&structured.Error{MoreInfo: "see docs", Err: errors.New("boom")}, "failed")
+	got = receiveJournald(t, conn)
+	if got["PRIORITY"] != "3" || got["MORE_INFO"] != "see docs" || got["ERROR"] != "boom" {
+		t.Errorf("got fields %v, want the structured error", got)
+	}
+}
+
+func TestJournaldCaptured(t *testing.T) {
+	conn := listenJournald(t)
+
+	zap.L().With(zap.String("k", "v")).Warn("captured")
+	got := receiveJournald(t, conn)
+	// the caller is only reported when enabled for the default scope
+	delete(got, "CODE_FILE")
+	delete(got, "CODE_LINE")
+	delete(got, "CODE_FUNC")
+
+	want := map[string]string{
+		"MESSAGE":           "captured",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "myapp",
+		"LOG_SCOPE":         "default",
+		"K":                 "v",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got fields %v, want %v", got, want)
+	}
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	cases := map[string]string{
+		"foo":                   "FOO",
+		"request-id":            "REQUEST_ID",
+		"_source":               "SOURCE",
+		"1st":                   "ST",
+		"__":                    "",
+		strings.Repeat("a", 70): strings.Repeat("A", 64),
+		"message":               "LABEL_MESSAGE",
+		"_PRIORITY":             "LABEL_PRIORITY",
+		"code.file":             "LABEL_CODE_FILE",
+		"log_scope":             "LABEL_LOG_SCOPE",
+		"message_text":          "MESSAGE_TEXT",
+	}
+	for label, want := range cases {
+		if got := journaldFieldName(label); got != want {
+			t.Errorf("journaldFieldName(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
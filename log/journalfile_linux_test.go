@@ -0,0 +1,53 @@
+package log
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournaldLargeMessage(t *testing.T) {
+	if _, err := os.Stat("/dev/shm"); err != nil {
+		t.Skip("no /dev/shm")
+	}
+	conn := listenJournald(t)
+
+	msg := strings.Repeat("x", 1024*1024)
+	Info(msg)
+
+	buf := make([]byte, 1024)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatalf("failed to receive journald message: %v", err)
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("expected a control message, got %v: %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("expected a file descriptor, got %v: %v", fds, err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+	// the descriptor shares the offset of the sender, journald reads the file from its start
+	b, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := parseJournald(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["MESSAGE"] != msg {
+		t.Errorf("got a message of %d bytes, want %d", len(fields["MESSAGE"]), len(msg))
+	}
+}
@@ -1,21 +1,53 @@
 package log
 
 import (
-	"fmt"
+	"strings"
+
 	"github.com/go-logr/logr"
 )
 
+// zapLogger is a logr.LogSink writing to a Scope.
+//
+// V levels up to the debug threshold are logged at info level, and greater ones at debug level. Errors and key-value
+// pairs passed to the logging functions are emitted as fields, while the values added by WithValues become labels.
 type zapLogger struct {
+	// l is the scope to log to, with its callerSkip adjusted to the depth of the logr.Logger.
 	l *Scope
+
+	// depth is how many frames were added to the callerSkip of l.
+	depth int
+
+	debugThreshold int
 }
 
+var (
+	_ logr.LogSink          = &zapLogger{}
+	_ logr.CallDepthLogSink = &zapLogger{}
+)
+
+// debugLevelThreshold is the default debug threshold of the logr adapters.
 const debugLevelThreshold = 3
 
-func (zl *zapLogger) Enabled(level int) bool {
-	if level > debugLevelThreshold {
-		return zl.l.DebugEnabled()
+// LogrOption configures a logr adapter created by NewLogrAdapter.
+type LogrOption func(zl *zapLogger)
+
+// WithLogrDebugThreshold sets the greatest V level which is logged at info level. Greater levels are logged at debug
+// level. The default is 3.
+func WithLogrDebugThreshold(v int) LogrOption {
+	return func(zl *zapLogger) {
+		zl.debugThreshold = v
+	}
+}
+
+func (zl *zapLogger) levelOf(v int) Level {
+	if v > zl.debugThreshold {
+		return DebugLevel
 	}
-	return zl.l.InfoEnabled()
+	return InfoLevel
+}
+
+func (zl *zapLogger) Enabled(level int) bool {
+	return zl.l.GetOutputLevel() >= zl.levelOf(level)
 }
 
 func trimNewline(msg string) string {
@@ -29,47 +61,113 @@ func trimNewline(msg string) string {
 	return msg
 }
 
-func (zl *zapLogger) Init(logr.RuntimeInfo) {
+// Init accounts for the frames of the logr.Logger in the callers reported.
+func (zl *zapLogger) Init(info logr.RuntimeInfo) {
+	zl.l = withCallerSkip(zl.l, info.CallDepth)
+	zl.depth += info.CallDepth
 }
 
 func (zl *zapLogger) Info(level int, msg string, keysAndVals ...any) {
-	if level > debugLevelThreshold {
-		zl.l.WithLabels(keysAndVals...).Debug(trimNewline(msg))
-	} else {
-		zl.l.WithLabels(keysAndVals...).Info(trimNewline(msg))
+	severity := zl.levelOf(level)
+	if zl.l.GetOutputLevel() < severity {
+		return
 	}
-}
 
-func (zl *zapLogger) Error(err error, msg string, keysAndVals ...any) {
-	if zl.l.ErrorEnabled() {
-		if err == nil {
-			zl.l.WithLabels(keysAndVals...).Error(trimNewline(msg))
-		} else {
-			zl.l.WithLabels(keysAndVals...).Error(fmt.Sprintf("%v: %s", err.Error(), msg))
-		}
+	fields := toFields(keysAndVals)
+	if level > 0 {
+		fields = append(fields, Int("v", level))
 	}
+	zl.l.callHandlers(severity, zl.l, nil, trimNewline(msg), fields)
 }
 
-func (zl *zapLogger) V(int) logr.Logger {
-	zlog := &zapLogger{
-		l: zl.l,
+func (zl *zapLogger) Error(err error, msg string, keysAndVals ...any) {
+	if !zl.l.ErrorEnabled() {
+		return
 	}
 
-	return logr.New(zlog)
+	fields := toFields(keysAndVals)
+	if err != nil {
+		fields = append(fields, Err(err))
+	}
+	zl.l.callHandlers(ErrorLevel, zl.l, nil, trimNewline(msg), fields)
 }
 
 func (zl *zapLogger) WithValues(keysAndValues ...any) logr.LogSink {
-	return NewLogrAdapter(zl.l.WithLabels(keysAndValues...)).GetSink()
+	out := *zl
+	out.l = zl.l.WithLabels(keysAndValues...)
+	return &out
 }
 
-func (zl *zapLogger) WithName(string) logr.LogSink {
-	return zl
+// WithName logs to a child scope, named after the scope and name joined by a slash. The child scope is registered
+// with the levels of its parent if it doesn't exist yet, so that its levels can be configured separately afterwards.
+func (zl *zapLogger) WithName(name string) logr.LogSink {
+	out := *zl
+	out.l = childScope(zl.l, name, zl.depth)
+	return &out
+}
+
+func (zl *zapLogger) WithCallDepth(depth int) logr.LogSink {
+	out := *zl
+	out.l = withCallerSkip(zl.l, depth)
+	out.depth += depth
+	return &out
+}
+
+// withCallerSkip returns a copy of s, reporting the caller depth frames further up the stack.
+func withCallerSkip(s *Scope, depth int) *Scope {
+	if depth == 0 {
+		return s
+	}
+	out := s.copy()
+	out.callerSkip += depth
+	return out
+}
+
+// childScope returns the child scope of parent with the given name, registering it if needed. The labels of parent
+// are carried over, as well as its callerSkip, depth of which are frames of the logr.Logger not registered with the
+// child scope.
+func childScope(parent *Scope, name string, depth int) *Scope {
+	name = strings.NewReplacer(":", "_", ",", "_", ".", "_").Replace(name)
+	if parent.name != DefaultScopeName {
+		name = parent.name + "/" + name
+	}
+
+	lock.Lock()
+	s, ok := scopes[name]
+	if !ok {
+		s = &Scope{
+			name:        name,
+			nameToEmit:  name,
+			description: parent.description,
+			callerSkip:  parent.callerSkip - depth,
+			labels:      make(map[string]any),
+		}
+		s.SetOutputLevel(parent.GetOutputLevel())
+		s.SetStackTraceLevel(parent.GetStackTraceLevel())
+		s.SetLogCallers(parent.GetLogCallers())
+		scopes[name] = s
+	}
+	lock.Unlock()
+
+	out := s.copy()
+	out.callerSkip = parent.callerSkip
+	for _, k := range parent.labelKeys {
+		if _, ok := out.labels[k]; !ok {
+			out.labelKeys = append(out.labelKeys, k)
+		}
+		out.labels[k] = parent.labels[k]
+	}
+	return out
 }
 
 // NewLogrAdapter creates a new logr.Logger using the given Zap Logger to log.
-func NewLogrAdapter(l *Scope) logr.Logger {
+func NewLogrAdapter(l *Scope, opts ...LogrOption) logr.Logger {
 	zlog := &zapLogger{
-		l: l,
+		l:              l,
+		debugThreshold: debugLevelThreshold,
+	}
+	for _, opt := range opts {
+		opt(zlog)
 	}
 
 	return logr.New(zlog)
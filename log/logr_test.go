@@ -2,7 +2,9 @@ package log
 
 import (
 	"errors"
+	"fmt"
 	"github.com/go-logr/logr"
+	"runtime"
 	"testing"
 )
 
@@ -62,7 +64,7 @@ func TestLogr(t *testing.T) {
 			l.Error(errors.New("some error"), "msg")
 		})
 		mustMatchLength(t, 1, lines)
-		mustRegexMatchString(t, lines[0], "some error.*msg")
+		mustRegexMatchString(t, lines[0], "msg\terror=some error")
 	})
 	t.Run("debug output still shows message", func(t *testing.T) {
 		s := newScope()
@@ -73,7 +75,7 @@ func TestLogr(t *testing.T) {
 		})
 		mustMatchLength(t, 2, lines)
 		mustRegexMatchString(t, lines[0], "msg")
-		mustRegexMatchString(t, lines[1], "some error.*msg")
+		mustRegexMatchString(t, lines[1], "msg\terror=some error")
 	})
 	t.Run("warn output still shows errors", func(t *testing.T) {
 		s := newScope()
@@ -83,7 +85,7 @@ func TestLogr(t *testing.T) {
 			l.Error(errors.New("some error"), "msg")
 		})
 		mustMatchLength(t, 1, lines)
-		mustRegexMatchString(t, lines[0], "some error.*msg")
+		mustRegexMatchString(t, lines[0], "msg\terror=some error")
 	})
 
 	t.Run("info shows correct verbosity", func(t *testing.T) {
@@ -128,6 +130,73 @@ func TestLogr(t *testing.T) {
 		mustRegexMatchString(t, lines[3], "3")
 		mustRegexMatchString(t, lines[4], "4")
 	})
+
+	t.Run("threshold is configurable", func(t *testing.T) {
+		lines, err := captureStdout(func() {
+			Configure(DefaultOptions())
+			l := NewLogrAdapter(newScope(), WithLogrDebugThreshold(1))
+			l.V(1).Info("1")
+			l.V(2).Info("2")
+			matchBool(t, false, l.V(2).Enabled())
+			_ = Sync()
+		})
+		if err != nil {
+			t.Fatalf("Got error '%v', expected success", err)
+		}
+		mustMatchLength(t, 2, lines)
+		mustRegexMatchString(t, lines[0], "1\tv=1")
+	})
+
+	t.Run("key values are fields", func(t *testing.T) {
+		lines := runLogrTest(t, func(l logr.Logger) {
+			l.WithValues("foo", "bar").Info("msg", "key", 1)
+		})
+		mustMatchLength(t, 1, lines)
+		mustRegexMatchString(t, lines[0], "msg\tfoo=bar key=1")
+	})
+
+	t.Run("callers are reported", func(t *testing.T) {
+		s := newScope()
+		s.SetLogCallers(true)
+		var line, fCallerLine int
+		lines := runLogrTestWithScope(t, s, func(l logr.Logger) {
+			_, _, fCallerLine, _ = runtime.Caller(1)
+			_, _, line, _ = runtime.Caller(0)
+			l.Info("msg")
+			l.WithName("child").WithValues("foo", "bar").Error(nil, "msg")
+			l.WithCallDepth(1).Info("msg")
+		})
+		mustMatchLength(t, 3, lines)
+		// the logging calls, then the call of f in runLogrTestWithScope
+		mustRegexMatchString(t, lines[0], fmt.Sprintf("logr_test.go:%d\\t", line+1))
+		mustRegexMatchString(t, lines[1], fmt.Sprintf("logr_test.go:%d\\t", line+2))
+		mustRegexMatchString(t, lines[2], fmt.Sprintf("logr_test.go:%d\\t", fCallerLine))
+	})
+}
+
+func TestLogrWithName(t *testing.T) {
+	s := RegisterScope("logrparent", "", 0)
+	defer func() {
+		lock.Lock()
+		delete(scopes, "logrparent")
+		delete(scopes, "logrparent/child_a")
+		lock.Unlock()
+	}()
+	s.SetOutputLevel(DebugLevel)
+
+	lines := runLogrTestWithScope(t, s.WithLabels("foo", "bar"), func(l logr.Logger) {
+		l.WithName("child.a").V(4).Info("msg")
+	})
+	mustMatchLength(t, 1, lines)
+	mustRegexMatchString(t, lines[0], "debug\tlogrparent/child_a\tmsg\tfoo=bar v=4")
+
+	child := FindScope("logrparent/child_a")
+	if child == nil {
+		t.Fatal("expected the child scope to be registered")
+	}
+	if child.GetOutputLevel() != DebugLevel {
+		t.Fatalf("expected the child scope to inherit the level of its parent, got %v", child.GetOutputLevel())
+	}
 }
 
 func matchBool(t *testing.T, want bool, got bool) {
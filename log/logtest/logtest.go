@@ -0,0 +1,188 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logtest captures the messages logged during a test, so that they can be asserted on.
+//
+//	rec := logtest.Capture(t, logtest.WithLevel("myscope", log.DebugLevel))
+//	doSomething()
+//
+//	// with gomega
+//	g.Expect(rec).To(logtest.ExpectEntry("myscope", log.WarnLevel, "retrying"))
+//
+//	// with testify
+//	assert.Condition(t, logtest.ExpectEntry("myscope", log.WarnLevel, "retrying").In(rec))
+package logtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"khetao.com/pkg/log"
+)
+
+// recorders tells the handlers of concurrent recorders apart.
+var recorders atomic.Uint64
+
+// Recorder records the messages logged by all scopes.
+type Recorder struct {
+	mu      sync.Mutex
+	entries []log.Entry
+}
+
+// Option configures a Recorder.
+type Option func(t testing.TB)
+
+// WithLevel sets the output level of the named scope for the duration of the test, so that less severe messages are
+// recorded as well. The previous level is restored when the test ends.
+func WithLevel(scope string, level log.Level) Option {
+	return func(t testing.TB) {
+		s := log.FindScope(scope)
+		if s == nil {
+			t.Fatalf("logtest: scope %q is not registered", scope)
+		}
+
+		prev := s.GetOutputLevel()
+		s.SetOutputLevel(level)
+		t.Cleanup(func() { s.SetOutputLevel(prev) })
+	}
+}
+
+// Capture starts recording the messages logged by all scopes, until the test ends. The messages are still written to
+// the configured outputs.
+func Capture(t testing.TB, opts ...Option) *Recorder {
+	t.Helper()
+
+	r := &Recorder{}
+	name := fmt.Sprintf("logtest-%d", recorders.Add(1))
+	t.Cleanup(log.RegisterHandler(name, r.record))
+
+	for _, opt := range opts {
+		opt(t)
+	}
+	return r
+}
+
+func (r *Recorder) record(e log.Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+}
+
+// Entries returns the messages recorded so far.
+func (r *Recorder) Entries() []log.Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]log.Entry(nil), r.entries...)
+}
+
+// Reset discards the messages recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+// Find returns the recorded messages matched by m.
+func (r *Recorder) Find(m *EntryMatcher) []log.Entry {
+	var found []log.Entry
+	for _, e := range r.Entries() {
+		if m.Matches(e) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// EntryMatcher matches messages by scope, level and text. It is a gomega matcher for a *Recorder or a []log.Entry,
+// which succeeds if any of the messages matches.
+type EntryMatcher struct {
+	scope     string
+	level     log.Level
+	substring string
+}
+
+// ExpectEntry returns a matcher of the messages of the given scope and level, whose text contains substring. An empty
+// scope matches any scope.
+func ExpectEntry(scope string, level log.Level, substring string) *EntryMatcher {
+	return &EntryMatcher{scope: scope, level: level, substring: substring}
+}
+
+// Matches returns whether e is matched.
+func (m *EntryMatcher) Matches(e log.Entry) bool {
+	return (m.scope == "" || e.Scope == m.scope) && e.Level == m.level && strings.Contains(e.Message, m.substring)
+}
+
+// In returns a condition which holds when any of the messages recorded by r is matched. It is an
+// assert.Comparison for testify.
+func (m *EntryMatcher) In(r *Recorder) func() bool {
+	return func() bool {
+		return len(r.Find(m)) > 0
+	}
+}
+
+// Match implements types.GomegaMatcher.
+func (m *EntryMatcher) Match(actual any) (bool, error) {
+	entries, err := toEntries(actual)
+	if err != nil {
+		return false, err
+	}
+
+	for _, e := range entries {
+		if m.Matches(e) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FailureMessage implements types.GomegaMatcher.
+func (m *EntryMatcher) FailureMessage(actual any) string {
+	return fmt.Sprintf("Expected a log entry matching %s, got:\n%s", m, describe(actual))
+}
+
+// NegatedFailureMessage implements types.GomegaMatcher.
+func (m *EntryMatcher) NegatedFailureMessage(actual any) string {
+	return fmt.Sprintf("Expected no log entry matching %s, got:\n%s", m, describe(actual))
+}
+
+func (m *EntryMatcher) String() string {
+	return fmt.Sprintf("scope=%q level=%v substring=%q", m.scope, m.level, m.substring)
+}
+
+func toEntries(actual any) ([]log.Entry, error) {
+	switch a := actual.(type) {
+	case *Recorder:
+		return a.Entries(), nil
+	case []log.Entry:
+		return a, nil
+	default:
+		return nil, fmt.Errorf("ExpectEntry expects a *logtest.Recorder or a []log.Entry, got %T", actual)
+	}
+}
+
+func describe(actual any) string {
+	entries, err := toEntries(actual)
+	if err != nil {
+		return err.Error()
+	}
+
+	sb := &strings.Builder{}
+	for _, e := range entries {
+		fmt.Fprintf(sb, "\t%s\t%v\t%s\t%v\n", e.Scope, e.Level, e.Message, e.Labels)
+	}
+	return sb.String()
+}
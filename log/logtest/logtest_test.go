@@ -0,0 +1,58 @@
+package logtest
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+
+	"khetao.com/pkg/log"
+	"khetao.com/pkg/structured"
+)
+
+var scope = log.RegisterScope("logtest", "logtest messages", 0)
+
+func TestCapture(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	t.Run("capture", func(t *testing.T) {
+		rec := Capture(t, WithLevel("logtest", log.DebugLevel))
+
+		scope.Debug("debugging")
+		scope.WithLabels("foo", "bar").Warnf("retrying in %ds", 5)
+		scope.Error(&structured.Error{MoreInfo: "see docs", Err: errors.New("boom")}, "failed")
+
+		g.Expect(rec).To(ExpectEntry("logtest", log.DebugLevel, "debugging"))
+		g.Expect(rec).To(ExpectEntry("", log.WarnLevel, "retrying in 5s"))
+		g.Expect(rec).NotTo(ExpectEntry("logtest", log.InfoLevel, "retrying"))
+		assert.Condition(t, ExpectEntry("logtest", log.ErrorLevel, "failed").In(rec))
+
+		warnings := rec.Find(ExpectEntry("logtest", log.WarnLevel, ""))
+		g.Expect(warnings).To(HaveLen(1))
+		g.Expect(warnings[0].Labels).To(HaveKeyWithValue("foo", "bar"))
+
+		errs := rec.Find(ExpectEntry("logtest", log.ErrorLevel, ""))
+		g.Expect(errs[0].Error.MoreInfo).To(Equal("see docs"))
+
+		rec.Reset()
+		g.Expect(rec.Entries()).To(BeEmpty())
+	})
+
+	// the level and the handler are restored after the test
+	g.Expect(scope.GetOutputLevel()).To(Equal(log.InfoLevel))
+	g.Expect(log.UnregisterHandler("logtest-1")).To(BeFalse())
+}
+
+func TestExpectEntryFailure(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	m := ExpectEntry("logtest", log.InfoLevel, "hello")
+	_, err := m.Match("hello")
+	g.Expect(err).To(HaveOccurred())
+
+	entries := []log.Entry{{Scope: "logtest", Level: log.InfoLevel, Message: "bye"}}
+	g.Expect(m.Match(entries)).To(BeFalse())
+	g.Expect(m.FailureMessage(entries)).To(ContainSubstring(`substring="hello"`))
+	g.Expect(m.FailureMessage(entries)).To(ContainSubstring("bye"))
+}
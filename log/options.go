@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"google.golang.org/genproto/googleapis/api/monitoredres"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -62,6 +64,12 @@ type Options struct {
 	outputLevels     string
 	logCallers       string
 	stackTraceLevels string
+	samplings        string
+	dedupWindow      time.Duration
+
+	redact         bool
+	redactKeys     []string
+	redactPatterns []*regexp.Regexp
 
 	useStackdriverFormat     bool
 	teeToStackdriver         bool
@@ -69,10 +77,31 @@ type Options struct {
 	stackdriverQuotaProject  string
 	stackdriverLogName       string
 	stackdriverResource      *monitoredres.MonitoredResource
+	stackdriverTraceProject  string
 
 	teeToUDSServer   bool
 	udsSocketAddress string
 	udsServerPath    string
+	udsBatchSize     int
+	udsFlushInterval time.Duration
+	udsQueueSize     int
+	udsDropPolicy    DropPolicy
+	udsRetries       int
+	udsRetryBackoff  time.Duration
+
+	teeToSocket      bool
+	socketNetwork    string
+	socketAddress    string
+	socketQueueSize  int
+	socketDropPolicy DropPolicy
+
+	syslogTarget   string
+	syslogFacility string
+	syslogAppName  string
+
+	teeToJournald      bool
+	journaldSocket     string
+	journaldIdentifier string
 }
 
 func DefaultOptions() *Options {
@@ -94,6 +123,14 @@ func (o *Options) WithStackdriverLoggingFormat() *Options {
 	return o
 }
 
+// WithStackdriverTraceProject sets the project the traces belong to, which the Stackdriver format needs for Cloud
+// Logging to link the messages to their trace. It defaults to the project of WithTeeToStackdriver, and without it, the
+// bare trace IDs are emitted.
+func (o *Options) WithStackdriverTraceProject(project string) *Options {
+	o.stackdriverTraceProject = project
+	return o
+}
+
 func (o *Options) WithTeeToStackdriver(project, logName string, mr *monitoredres.MonitoredResource) *Options {
 	o.teeToStackdriver = true
 	o.stackdriverTargetProject = project
@@ -112,6 +149,24 @@ func (o *Options) WithTeeToStackdriverWithQuotaProject(project, quotaProject, lo
 	return o
 }
 
+// WithDeduplication collapses identical messages, that is messages of the same scope, level, text and labels, logged
+// within window: the first one is output, and the number of the others is reported in a summary line when the window
+// closes, or when Sync or Close is called.
+func (o *Options) WithDeduplication(window time.Duration) *Options {
+	o.dedupWindow = window
+	return o
+}
+
+// WithRedaction masks sensitive data before it reaches any output: the values of the labels and fields whose name
+// contains one of keys, regardless of case, and the substrings of messages and values matched by one of patterns.
+// DefaultRedactedKeys and DefaultRedactionPatterns provide common choices.
+func (o *Options) WithRedaction(keys []string, patterns []*regexp.Regexp) *Options {
+	o.redact = true
+	o.redactKeys = keys
+	o.redactPatterns = patterns
+	return o
+}
+
 func (o *Options) WithTeeToUDS(addr, path string) *Options {
 	o.teeToUDSServer = true
 	o.udsSocketAddress = addr
@@ -119,6 +174,69 @@ func (o *Options) WithTeeToUDS(addr, path string) *Options {
 	return o
 }
 
+// WithUDSBatching sets the maximum number of entries sent to the UDS server per request, and how often the queued
+// entries are sent. By default, batches of 100 entries are sent every second.
+func (o *Options) WithUDSBatching(size int, interval time.Duration) *Options {
+	o.udsBatchSize = size
+	o.udsFlushInterval = interval
+	return o
+}
+
+// WithUDSQueue bounds the number of entries waiting to be sent to the UDS server, and selects the entries dropped
+// once it is reached. By default, up to 10000 entries are queued, and the oldest ones are dropped.
+func (o *Options) WithUDSQueue(size int, policy DropPolicy) *Options {
+	o.udsQueueSize = size
+	o.udsDropPolicy = policy
+	return o
+}
+
+// WithUDSRetries sets how many times a failed request to the UDS server is retried, waiting backoff before the first
+// retry, and twice as long before each of the next ones. A negative number of retries disables them. By default,
+// requests are retried 3 times, starting after 100ms.
+func (o *Options) WithUDSRetries(retries int, backoff time.Duration) *Options {
+	o.udsRetries = retries
+	o.udsRetryBackoff = backoff
+	return o
+}
+
+// WithTeeToSocket also writes the entries as newline-delimited JSON to a persistent connection to addr, on the
+// given "unix" or "tcp" network. The connection is reestablished automatically, and the entries are queued meanwhile.
+func (o *Options) WithTeeToSocket(network, addr string) *Options {
+	o.teeToSocket = true
+	o.socketNetwork = network
+	o.socketAddress = addr
+	return o
+}
+
+// WithSocketQueue bounds the number of entries waiting to be written to the socket, and selects the entries dropped
+// once it is reached. By default, up to 10000 entries are queued, and the oldest ones are dropped.
+func (o *Options) WithSocketQueue(size int, policy DropPolicy) *Options {
+	o.socketQueueSize = size
+	o.socketDropPolicy = policy
+	return o
+}
+
+// WithSyslog also writes the messages to syslog, formatted as per RFC 5424, at target in the form of
+// unix:///dev/log, udp://host:port or tcp://host:port. facility is one of kern, user, mail, daemon, auth, syslog,
+// lpr, news, uucp, cron, authpriv, ftp and local0 to local7, user by default. appName defaults to the name of the
+// executable.
+func (o *Options) WithSyslog(target, facility, appName string) *Options {
+	o.syslogTarget = target
+	o.syslogFacility = facility
+	o.syslogAppName = appName
+	return o
+}
+
+// WithJournald also writes the messages to journald, with its native protocol, so that their labels are kept as
+// separate journal fields. socket defaults to DefaultJournaldSocket, and identifier, the SYSLOG_IDENTIFIER of the
+// messages, to the name of the executable.
+func (o *Options) WithJournald(socket, identifier string) *Options {
+	o.teeToJournald = true
+	o.journaldSocket = socket
+	o.journaldIdentifier = identifier
+	return o
+}
+
 func (o *Options) SetOutputLevel(scope string, level Level) {
 	sl := scope + ":" + levelToString[level]
 	levels := strings.Split(o.outputLevels, ",")
@@ -261,6 +379,21 @@ func (o *Options) GetLogCallers(scope string) bool {
 	return false
 }
 
+// SetSampling sets the sampling of the given scope: within every interval, only the first messages with the same level
+// and text are output, followed by every thereafter-th one. A thereafter of 0 drops all messages beyond the first.
+func (o *Options) SetSampling(scope string, first, thereafter int, interval time.Duration) {
+	spec := fmt.Sprintf("%s:%d/%d/%v", scope, first, thereafter, interval)
+
+	var specs []string
+	prefix := scope + ":"
+	for _, s := range strings.Split(o.samplings, ",") {
+		if s != "" && !strings.HasPrefix(s, prefix) {
+			specs = append(specs, s)
+		}
+	}
+	o.samplings = strings.Join(append(specs, spec), ",")
+}
+
 func convertScopedLevel(sl string) (string, Level, error) {
 	var s string
 	var l string
@@ -301,6 +434,16 @@ func (o *Options) AttachFlags(
 	stringArrayVar(&o.OutputPaths, "log_target", o.OutputPaths,
 		"The set of paths where to output the log. This can be any path as well as the special values stdout and stderr")
 
+	stringVar(&o.syslogTarget, "log_syslog_target", o.syslogTarget,
+		"The syslog server where to also output the log, in the form of unix:///dev/log, udp://host:port or tcp://host:port")
+
+	stringVar(&o.syslogFacility, "log_syslog_facility", o.syslogFacility,
+		"The syslog facility of the log, one of kern, user, mail, daemon, auth, syslog, lpr, news, uucp, cron, authpriv, "+
+			"ftp and local0 to local7 (user if empty)")
+
+	stringVar(&o.syslogAppName, "log_syslog_app_name", o.syslogAppName,
+		"The syslog app-name of the log (the name of the executable if empty)")
+
 	stringVar(&o.RotateOutputPath, "log_rotate", o.RotateOutputPath,
 		"The path for the optional rotating log file")
 
@@ -346,6 +489,11 @@ func (o *Options) AttachFlags(
 
 		stringVar(&o.logCallers, "log_caller", o.logCallers,
 			fmt.Sprintf("Comma-separated list of scopes for which to include caller information, scopes can be any of [%s]", s))
+
+		stringVar(&o.samplings, "log_sampling", o.samplings,
+			fmt.Sprintf("Comma-separated per-scope sampling of messages to output, in the form of "+
+				"<scope>:<first>/<thereafter>/<interval>,... where scope can be one of [%s]. Within every interval, "+
+				"only the first messages with the same level and text are output, followed by every thereafter-th one", s))
 	} else {
 		stringVar(&o.outputLevels, "log_output_level", o.outputLevels,
 			fmt.Sprintf("The minimum logging level of messages to output,  can be one of %s",
@@ -357,6 +505,10 @@ func (o *Options) AttachFlags(
 
 		stringVar(&o.logCallers, "log_caller", o.logCallers,
 			"Comma-separated list of scopes for which to include called information, scopes can be any of [default]")
+
+		stringVar(&o.samplings, "log_sampling", o.samplings,
+			"Sampling of messages to output, in the form of <first>/<thereafter>/<interval>. Within every interval, "+
+				"only the first messages with the same level and text are output, followed by every thereafter-th one")
 	}
 
 	// NOTE: we don't currently expose a command-line option to control ErrorOutputPaths since it
@@ -197,6 +197,30 @@ func TestOpts(t *testing.T) {
 			RotationMaxBackups: defaultRotationMaxBackups,
 		}},
 
+		{"--log_sampling default:10/100/1s", Options{
+			OutputPaths:        []string{defaultOutputPath},
+			ErrorOutputPaths:   []string{defaultErrorOutputPath},
+			outputLevels:       DefaultScopeName + ":" + levelToString[defaultOutputLevel],
+			stackTraceLevels:   DefaultScopeName + ":" + levelToString[defaultStackTraceLevel],
+			samplings:          "default:10/100/1s",
+			RotationMaxAge:     defaultRotationMaxAge,
+			RotationMaxSize:    defaultRotationMaxSize,
+			RotationMaxBackups: defaultRotationMaxBackups,
+		}},
+
+		{"--log_syslog_target udp://localhost:514 --log_syslog_facility local0 --log_syslog_app_name app", Options{
+			OutputPaths:        []string{defaultOutputPath},
+			ErrorOutputPaths:   []string{defaultErrorOutputPath},
+			outputLevels:       DefaultScopeName + ":" + levelToString[defaultOutputLevel],
+			stackTraceLevels:   DefaultScopeName + ":" + levelToString[defaultStackTraceLevel],
+			syslogTarget:       "udp://localhost:514",
+			syslogFacility:     "local0",
+			syslogAppName:      "app",
+			RotationMaxAge:     defaultRotationMaxAge,
+			RotationMaxSize:    defaultRotationMaxSize,
+			RotationMaxBackups: defaultRotationMaxBackups,
+		}},
+
 		{"--log_rotate foobar", Options{
 			OutputPaths:        []string{defaultOutputPath},
 			ErrorOutputPaths:   []string{defaultErrorOutputPath},
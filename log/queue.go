@@ -0,0 +1,157 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultQueueSize is the default number of entries a log sink queues at most.
+const defaultQueueSize = 10000
+
+// DropPolicy selects the entries dropped when the queue of a log sink is full.
+type DropPolicy int
+
+const (
+	// DropOldest drops the oldest queued entry to make room for the new one.
+	DropOldest DropPolicy = iota
+	// DropNewest drops the new entry.
+	DropNewest
+)
+
+// entryQueue is a bounded queue of encoded entries, waiting to be sent by a log sink.
+type entryQueue struct {
+	size   int
+	policy DropPolicy
+
+	mu      sync.Mutex
+	entries []string
+	dropped int
+}
+
+func newEntryQueue(size int, policy DropPolicy) *entryQueue {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	return &entryQueue{size: size, policy: policy}
+}
+
+// push queues msg, dropping an entry if the queue is full. It returns the number of queued entries.
+func (q *entryQueue) push(msg string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) >= q.size {
+		q.dropped++
+		if q.policy == DropNewest {
+			return len(q.entries)
+		}
+		q.entries = q.entries[1:]
+	}
+	q.entries = append(q.entries, msg)
+	return len(q.entries)
+}
+
+// take dequeues up to n entries, all of them if n is 0, and returns them along with the number of entries dropped
+// since the last call.
+func (q *entryQueue) take(n int) ([]string, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if n <= 0 || n > len(q.entries) {
+		n = len(q.entries)
+	}
+	batch := q.entries[:n:n]
+	q.entries = q.entries[n:]
+
+	dropped := q.dropped
+	q.dropped = 0
+	return batch, dropped
+}
+
+// requeue puts batch back at the front of the queue, dropping entries if the queue is full.
+func (q *entryQueue) requeue(batch []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]string, 0, len(batch)+len(q.entries))
+	entries = append(entries, batch...)
+	entries = append(entries, q.entries...)
+	if over := len(entries) - q.size; over > 0 {
+		q.dropped += over
+		if q.policy == DropNewest {
+			entries = entries[:q.size]
+		} else {
+			entries = entries[over:]
+		}
+	}
+	q.entries = entries
+}
+
+// queueSink sends the entries queued by a queueCore to a log server.
+type queueSink interface {
+	// enqueue queues an encoded entry, to be sent in the background.
+	enqueue(msg string)
+	// flush sends the queued entries.
+	flush() error
+}
+
+// queueCore encodes the entries as JSON and queues them to a queueSink.
+type queueCore struct {
+	minimumLevel zapcore.Level
+	enc          zapcore.Encoder
+	sink         queueSink
+}
+
+// teeToSink returns a core writing to baseCore, and to sink from the minimum level enabled by baseCore.
+func teeToSink(baseCore zapcore.Core, sink queueSink) zapcore.Core {
+	qc := &queueCore{
+		enc:  zapcore.NewJSONEncoder(defaultEncoderConfig),
+		sink: sink,
+	}
+	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
+		if baseCore.Enabled(l) {
+			qc.minimumLevel = l
+			break
+		}
+	}
+	return zapcore.NewTee(baseCore, qc)
+}
+
+func (q *queueCore) Enabled(level zapcore.Level) bool {
+	return level >= q.minimumLevel
+}
+
+func (q *queueCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := q.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &queueCore{
+		minimumLevel: q.minimumLevel,
+		enc:          enc,
+		sink:         q.sink,
+	}
+}
+
+func (q *queueCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if q.Enabled(entry.Level) {
+		return ce.AddCore(entry, q)
+	}
+	return ce
+}
+
+func (q *queueCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buffer, err := q.enc.EncodeEntry(entry, fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode log entry: %v", err)
+	}
+	q.sink.enqueue(buffer.String())
+	buffer.Free()
+	return nil
+}
+
+func (q *queueCore) Sync() error {
+	return q.sink.flush()
+}
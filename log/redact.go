@@ -0,0 +1,239 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"khetao.com/pkg/structured"
+)
+
+// redacted replaces the values which are masked.
+const redacted = "***"
+
+var (
+	// DefaultRedactedKeys are the label names whose values are masked by default, see Options.WithRedaction.
+	DefaultRedactedKeys = []string{"password", "token", "authorization", "secret"}
+
+	// DefaultRedactionPatterns match the substrings which are masked by default, see Options.WithRedaction: bearer
+	// tokens, AWS access keys and email addresses.
+	DefaultRedactionPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+		regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+)
+
+// Secret is a string which is always output as ***, whether redaction is enabled or not.
+//
+//	s.WithLabels("apiKey", log.Secret(key)).Info("Connecting")
+type Secret string
+
+// String implements fmt.Stringer.
+func (Secret) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer.
+func (Secret) GoString() string {
+	return redacted
+}
+
+// MarshalJSON implements json.Marshaler.
+func (Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// the redaction stage, nil unless enabled with Options.WithRedaction
+var redaction atomic.Pointer[redactor]
+
+// redactor masks the values of sensitive labels, and the sensitive substrings of messages and values.
+type redactor struct {
+	keys     []string
+	patterns []*regexp.Regexp
+}
+
+func newRedactor(keys []string, patterns []*regexp.Regexp) *redactor {
+	r := &redactor{patterns: patterns}
+	for _, k := range keys {
+		r.keys = append(r.keys, strings.ToLower(k))
+	}
+	return r
+}
+
+// sensitive returns whether the values of the label named key are masked.
+func (r *redactor) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range r.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// string masks the sensitive substrings of s.
+func (r *redactor) string(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// value masks the value of the label named key.
+func (r *redactor) value(key string, v any) any {
+	if r.sensitive(key) {
+		return redacted
+	}
+
+	switch v := v.(type) {
+	case string:
+		return r.string(v)
+	case error:
+		return r.string(v.Error())
+	default:
+		return v
+	}
+}
+
+// field masks the value of a field.
+func (r *redactor) field(f Field) Field {
+	if f.Key != "" && r.sensitive(f.Key) {
+		return zap.String(f.Key, redacted)
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.string(f.String)
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			return zap.String(f.Key, r.string(err.Error()))
+		}
+	case zapcore.StringerType:
+		return zap.String(f.Key, r.string(f.Interface.(interface{ String() string }).String()))
+	case zapcore.ReflectType:
+		if s, ok := f.Interface.(string); ok {
+			return zap.String(f.Key, r.string(s))
+		}
+	}
+	return f
+}
+
+// fields masks the values of fields.
+func (r *redactor) fields(fields []Field) []Field {
+	if len(fields) == 0 {
+		return fields
+	}
+
+	out := make([]Field, len(fields))
+	for i, f := range fields {
+		out[i] = r.field(f)
+	}
+	return out
+}
+
+// labels returns a scope with the values of the labels of s masked, or s if there is none.
+func (r *redactor) labels(s *Scope) *Scope {
+	if len(s.labelKeys) == 0 {
+		return s
+	}
+
+	out := s.copy()
+	for _, k := range out.labelKeys {
+		out.labels[k] = r.value(k, out.labels[k])
+	}
+	return out
+}
+
+// error returns a copy of ie with its fields masked.
+func (r *redactor) error(ie *structured.Error) *structured.Error {
+	if ie == nil {
+		return nil
+	}
+
+	out := *ie
+	out.MoreInfo = r.string(ie.MoreInfo)
+	out.Impact = r.string(ie.Impact)
+	out.Action = r.string(ie.Action)
+	out.LikelyCause = r.string(ie.LikelyCause)
+	if ie.Err != nil {
+		out.Err = redactedError{msg: r.string(ie.Err.Error()), err: ie.Err}
+	}
+	return &out
+}
+
+// redactedError is an error whose message has been masked.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e redactedError) Error() string {
+	return e.msg
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactingCore masks the messages and fields written to the core it wraps, which makes redaction apply to any sink,
+// including the output of the global zap logger and the standard log package.
+type redactingCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+func newRedactingCore(core zapcore.Core, r *redactor) zapcore.Core {
+	return &redactingCore{Core: core, r: r}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.r.fields(fields)), r: c.r}
+}
+
+// Check lets the wrapped core select the cores the entry is written to, as a tee only selects its cores enabled for
+// the entry, and writes the entry redacted to them.
+func (c *redactingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if checked := c.Core.Check(e, nil); checked != nil {
+		return ce.AddCore(e, &redactedEntryCore{Core: c.Core, checked: checked, r: c.r})
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	e.Message = c.r.string(e.Message)
+	return c.Core.Write(e, c.r.fields(fields))
+}
+
+// redactedEntryCore writes an entry, once redacted, to the cores selected by the core wrapped by a redactingCore.
+type redactedEntryCore struct {
+	zapcore.Core
+	checked *zapcore.CheckedEntry
+	r       *redactor
+}
+
+func (c *redactedEntryCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	// the errors of the selected cores are reported as those of the outputs handled by the scopes
+	c.checked.ErrorOutput = funcs.Load().(patchTable).errorSink
+	c.checked.Entry.Message = c.r.string(e.Message)
+	c.checked.Write(c.r.fields(fields)...)
+	return nil
+}
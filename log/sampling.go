@@ -0,0 +1,190 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// samplingKey identifies the messages which are counted together.
+type samplingKey struct {
+	level Level
+	msg   string
+}
+
+// sampler limits the output of a scope: within each interval, the first messages with the same level and text are
+// output, and only every thereafter-th one after that. The number of dropped messages is reported in a summary line at
+// the end of the interval.
+type sampler struct {
+	first      int
+	thereafter int
+	interval   time.Duration
+
+	mu      sync.Mutex
+	start   time.Time
+	counts  map[samplingKey]int
+	dropped int
+	timer   *time.Timer
+}
+
+func newSampler(first, thereafter int, interval time.Duration) *sampler {
+	return &sampler{
+		first:      first,
+		thereafter: thereafter,
+		interval:   interval,
+		counts:     make(map[samplingKey]int),
+	}
+}
+
+// allow counts a message, and returns whether it should be output.
+func (sp *sampler) allow(s *Scope, level Level, msg string) bool {
+	if level == FatalLevel {
+		return true
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(sp.start) >= sp.interval {
+		sp.start = now
+		sp.counts = make(map[samplingKey]int)
+	}
+
+	key := samplingKey{level: level, msg: msg}
+	sp.counts[key]++
+	n := sp.counts[key]
+	if n <= sp.first || (sp.thereafter > 0 && (n-sp.first)%sp.thereafter == 0) {
+		return true
+	}
+
+	sp.dropped++
+	if sp.timer == nil {
+		sp.timer = time.AfterFunc(sp.start.Add(sp.interval).Sub(now), func() { sp.report(s) })
+	}
+	return false
+}
+
+// report outputs the number of messages dropped since the previous report.
+func (sp *sampler) report(s *Scope) {
+	sp.mu.Lock()
+	dropped := sp.dropped
+	sp.dropped = 0
+	sp.timer = nil
+	sp.mu.Unlock()
+
+	if dropped > 0 {
+		s.dispatch(WarnLevel, s, nil, fmt.Sprintf("sampling dropped %d log entries in the last %v", dropped, sp.interval),
+			[]Field{Int("dropped", dropped)})
+	}
+}
+
+// stop cancels the pending report, if any, and outputs it right away.
+func (sp *sampler) stop(s *Scope) {
+	sp.mu.Lock()
+	pending := sp.timer != nil && sp.timer.Stop()
+	sp.mu.Unlock()
+
+	if pending {
+		sp.report(s)
+	}
+}
+
+// convertScopedSampling parses a sampling spec in the form of <scope>:<first>/<thereafter>/<interval>. The scope
+// defaults to the default scope.
+func convertScopedSampling(ss string) (string, *sampler, error) {
+	s := DefaultScopeName
+	spec := ss
+
+	pieces := strings.Split(ss, ":")
+	if len(pieces) == 2 {
+		s = pieces[0]
+		spec = pieces[1]
+	} else if len(pieces) > 2 {
+		return "", nil, fmt.Errorf("invalid sampling format '%s'", ss)
+	}
+
+	parts := strings.Split(spec, "/")
+	if len(parts) != 3 {
+		return "", nil, fmt.Errorf("invalid sampling format '%s'", ss)
+	}
+
+	first, err := strconv.Atoi(parts[0])
+	if err != nil || first < 0 {
+		return "", nil, fmt.Errorf("invalid sampling first count '%s'", ss)
+	}
+	thereafter, err := strconv.Atoi(parts[1])
+	if err != nil || thereafter < 0 {
+		return "", nil, fmt.Errorf("invalid sampling thereafter count '%s'", ss)
+	}
+	interval, err := time.ParseDuration(parts[2])
+	if err != nil || interval <= 0 {
+		return "", nil, fmt.Errorf("invalid sampling interval '%s'", ss)
+	}
+
+	return s, newSampler(first, thereafter, interval), nil
+}
+
+// processSamplings applies the sampling specs to the scopes, replacing the previous ones. It supports the use of a
+// global override.
+func processSamplings(allScopes map[string]*Scope, arg string) error {
+	samplers := make(map[*Scope]*sampler, len(allScopes))
+	for _, ss := range strings.Split(arg, ",") {
+		if ss == "" {
+			continue
+		}
+
+		name, sp, err := convertScopedSampling(ss)
+		if err != nil {
+			return err
+		}
+
+		if name == OverrideScopeName {
+			for _, scope := range allScopes {
+				// every scope counts its messages separately
+				samplers[scope] = newSampler(sp.first, sp.thereafter, sp.interval)
+			}
+		} else if scope, ok := allScopes[name]; ok {
+			samplers[scope] = sp
+		}
+	}
+
+	for _, scope := range allScopes {
+		scope.setSampler(samplers[scope])
+	}
+	return nil
+}
+
+// setSampler replaces the sampler of the scope, reporting the messages dropped by the previous one.
+func (s *Scope) setSampler(sp *sampler) {
+	prev, _ := s.sampler.Swap(samplerHolder{sp}).(samplerHolder)
+	if prev.sampler != nil {
+		prev.sampler.stop(s)
+	}
+}
+
+// samplerHolder allows storing a nil sampler in an atomic.Value.
+type samplerHolder struct {
+	sampler *sampler
+}
+
+func (s *Scope) getSampler() *sampler {
+	h, _ := s.sampler.Load().(samplerHolder)
+	return h.sampler
+}
@@ -0,0 +1,84 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	s := RegisterScope("TestSampling", "Desc", 0)
+
+	o := DefaultOptions()
+	o.SetSampling("TestSampling", 2, 3, 100*time.Millisecond)
+	o.SetSampling("TestSampling", 2, 3, time.Hour)
+	if o.samplings != "TestSampling:2/3/1h0m0s" {
+		t.Fatalf("SetSampling() got %q", o.samplings)
+	}
+
+	lines, err := captureStdout(func() {
+		if err := Configure(o); err != nil {
+			t.Fatalf("Configure() failed: %v", err)
+		}
+		for i := 1; i <= 10; i++ {
+			s.Infof("Hello %d", i%2)
+		}
+		s.Info("Other")
+
+		// reconfiguring reports the dropped messages
+		_ = Configure(DefaultOptions())
+		s.Info("Unsampled")
+		s.Info("Unsampled")
+		_ = Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	// both messages are logged 5 times, the first 2 times and the 5th are output
+	want := []string{
+		`Hello 1$`, `Hello 0$`, `Hello 1$`, `Hello 0$`, `Hello 1$`, `Hello 0$`,
+		`Other$`,
+		`warn	TestSampling	sampling dropped 4 log entries in the last 1h0m0s	dropped=4$`,
+		`Unsampled$`, `Unsampled$`,
+	}
+	if len(lines) != len(want)+1 {
+		t.Fatalf("Got %d lines, expected %d: %v", len(lines), len(want), lines)
+	}
+	for i, w := range want {
+		mustRegexMatchString(t, lines[i], w)
+	}
+}
+
+func TestSamplingSummary(t *testing.T) {
+	s := RegisterScope("TestSamplingSummary", "Desc", 0)
+
+	lines, err := captureStdout(func() {
+		o := DefaultOptions()
+		o.samplings = "all:1/0/50ms"
+		if err := Configure(o); err != nil {
+			t.Fatalf("Configure() failed: %v", err)
+		}
+		s.Warn("Hello")
+		s.Warn("Hello")
+		time.Sleep(200 * time.Millisecond)
+		_ = Configure(DefaultOptions())
+		_ = Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	mustRegexMatchString(t, lines[0], `Hello$`)
+	mustRegexMatchString(t, lines[1], `sampling dropped 1 log entries in the last 50ms	dropped=1$`)
+}
+
+func TestBadSampling(t *testing.T) {
+	for _, spec := range []string{"a:b:1/1/1s", "1/1", "x/1/1s", "1/-1/1s", "1/1/0s", "1/1/foo"} {
+		o := DefaultOptions()
+		o.samplings = spec
+		if err := Configure(o); err == nil {
+			t.Errorf("Configure() with sampling %q succeeded, expected an error", spec)
+		}
+	}
+	_ = Configure(DefaultOptions())
+}
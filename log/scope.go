@@ -17,9 +17,13 @@ package log
 import (
 	"fmt"
 	"khetao.com/pkg/structured"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
 )
 
 // Scope constrains logging control to a named scope level. It gives users a fine grained control over output severity
@@ -43,6 +47,12 @@ import (
 //	  <time>   info   MyScope   Hello  moreInfo=See the documentation in istio.io/helpful_link foo=bar
 //
 // See structured.Error for additional guidance on defining errors in a dictionary.
+//
+// Data which only concerns a single message is better passed to the *w functions, as typed fields or key-value
+// pairs, which doesn't copy the labels of the scope:
+//
+//	s.Infow("Request done", log.String("path", "/foo"), log.Duration("elapsed", d), "status", 200)
+//	  <time>   info   MyScope   Request done  path=/foo elapsed=1.5s status=200
 type Scope struct {
 	// immutable, set at creation
 	name        string
@@ -54,18 +64,31 @@ type Scope struct {
 	outputLevel     atomic.Value
 	stackTraceLevel atomic.Value
 	logCallers      atomic.Value
+	sampler         atomic.Value
 
 	// labels data - key slice to preserve ordering
 	labelKeys []string
 	labels    map[string]any
+
+	// the caller and time of a record logged through another API, such as slog, if any
+	source *recordSource
+}
+
+// recordSource is the caller and time of a record logged through another API, which are emitted rather than those
+// of the call to the handlers.
+type recordSource struct {
+	pc   uintptr
+	time time.Time
 }
 
 var (
 	scopes = make(map[string]*Scope)
 	lock   sync.RWMutex
 
-	defaultHandlers []scopeHandlerCallbackFunc
-	// Write lock should only be taken during program startup.
+	// defaultHandlers is replaced, never modified in place, so that it can be called without holding the lock, and
+	// handlers can register or unregister handlers themselves.
+	defaultHandlers []handlerRegistration
+	// Write lock is only taken when handlers are registered or unregistered.
 	defaultHandlersMu sync.RWMutex
 )
 
@@ -75,14 +98,43 @@ type scopeHandlerCallbackFunc func(
 	level Level,
 	scope *Scope,
 	ie *structured.Error,
-	msg string)
+	msg string,
+	fields []Field)
 
 // registerDefaultHandler registers a scope handler that is called by default from all scopes. It is appended to the
 // current list of default scope handlers.
 func registerDefaultHandler(callback scopeHandlerCallbackFunc) {
 	defaultHandlersMu.Lock()
 	defer defaultHandlersMu.Unlock()
-	defaultHandlers = append(defaultHandlers, callback)
+	handlers := make([]handlerRegistration, 0, len(defaultHandlers)+1)
+	defaultHandlers = append(append(handlers, defaultHandlers...), handlerRegistration{handle: callback})
+}
+
+// setOutputHandler installs callback as the default scope handler with the given name, replacing the previous one
+// if any, or removes it if callback is nil. It is used by the outputs which need the scope and labels of messages
+// separately. The callback is called first, so that it gets fatal messages before the process exits.
+func setOutputHandler(name string, callback scopeHandlerCallbackFunc) {
+	defaultHandlersMu.Lock()
+	defer defaultHandlersMu.Unlock()
+
+	handlers := make([]handlerRegistration, 0, len(defaultHandlers)+1)
+	if callback != nil {
+		handlers = append(handlers, handlerRegistration{name: name, handle: callback})
+	}
+	for _, h := range defaultHandlers {
+		if h.id != 0 || h.name != name {
+			handlers = append(handlers, h)
+		}
+	}
+	defaultHandlers = handlers
+}
+
+// handlerRegistration is a scope handler, along with the name and id it was registered with by RegisterHandler. The
+// id of the default handlers is 0.
+type handlerRegistration struct {
+	name   string
+	id     uint64
+	handle scopeHandlerCallbackFunc
 }
 
 // RegisterScope registers a new logging scope. If the same name is used multiple times
@@ -147,10 +199,10 @@ func (s *Scope) Fatal(args ...any) {
 	if s.GetOutputLevel() >= FatalLevel {
 		ie, firstIdx := getErrorStruct(args)
 		if firstIdx == 0 {
-			s.callHandlers(FatalLevel, s, ie, fmt.Sprint(args...))
+			s.callHandlers(FatalLevel, s, ie, fmt.Sprint(args...), nil)
 			return
 		}
-		s.callHandlers(FatalLevel, s, ie, fmt.Sprint(args[firstIdx:]...))
+		s.callHandlers(FatalLevel, s, ie, fmt.Sprint(args[firstIdx:]...), nil)
 	}
 }
 
@@ -162,7 +214,7 @@ func (s *Scope) Fatalf(args ...any) {
 		if len(args) > 1 {
 			msg = fmt.Sprintf(msg, args[firstIdx+1:]...)
 		}
-		s.callHandlers(FatalLevel, s, ie, msg)
+		s.callHandlers(FatalLevel, s, ie, msg, nil)
 	}
 }
 
@@ -176,10 +228,10 @@ func (s *Scope) Error(args ...any) {
 	if s.GetOutputLevel() >= ErrorLevel {
 		ie, firstIdx := getErrorStruct(args)
 		if firstIdx == 0 {
-			s.callHandlers(ErrorLevel, s, ie, fmt.Sprint(args...))
+			s.callHandlers(ErrorLevel, s, ie, fmt.Sprint(args...), nil)
 			return
 		}
-		s.callHandlers(ErrorLevel, s, ie, fmt.Sprint(args[firstIdx:]...))
+		s.callHandlers(ErrorLevel, s, ie, fmt.Sprint(args[firstIdx:]...), nil)
 	}
 }
 
@@ -191,7 +243,15 @@ func (s *Scope) Errorf(args ...any) {
 		if len(args) > 1 {
 			msg = fmt.Sprintf(msg, args[firstIdx+1:]...)
 		}
-		s.callHandlers(ErrorLevel, s, ie, msg)
+		s.callHandlers(ErrorLevel, s, ie, msg, nil)
+	}
+}
+
+// Errorw outputs a message at error level, with fields given either as Field values or as alternating keys and
+// values.
+func (s *Scope) Errorw(msg string, kvlist ...any) {
+	if s.GetOutputLevel() >= ErrorLevel {
+		s.callHandlers(ErrorLevel, s, nil, msg, toFields(kvlist))
 	}
 }
 
@@ -205,10 +265,10 @@ func (s *Scope) Warn(args ...any) {
 	if s.GetOutputLevel() >= WarnLevel {
 		ie, firstIdx := getErrorStruct(args)
 		if firstIdx == 0 {
-			s.callHandlers(WarnLevel, s, ie, fmt.Sprint(args...))
+			s.callHandlers(WarnLevel, s, ie, fmt.Sprint(args...), nil)
 			return
 		}
-		s.callHandlers(WarnLevel, s, ie, fmt.Sprint(args[firstIdx:]...))
+		s.callHandlers(WarnLevel, s, ie, fmt.Sprint(args[firstIdx:]...), nil)
 	}
 }
 
@@ -226,7 +286,15 @@ func (s *Scope) Warnf(args ...any) {
 		if len(args) > 1 {
 			msg = fmt.Sprintf(msg, args[firstIdx+1:]...)
 		}
-		s.callHandlers(WarnLevel, s, ie, msg)
+		s.callHandlers(WarnLevel, s, ie, msg, nil)
+	}
+}
+
+// Warnw outputs a message at warn level, with fields given either as Field values or as alternating keys and
+// values.
+func (s *Scope) Warnw(msg string, kvlist ...any) {
+	if s.GetOutputLevel() >= WarnLevel {
+		s.callHandlers(WarnLevel, s, nil, msg, toFields(kvlist))
 	}
 }
 
@@ -240,10 +308,10 @@ func (s *Scope) Info(args ...any) {
 	if s.GetOutputLevel() >= InfoLevel {
 		ie, firstIdx := getErrorStruct(args)
 		if firstIdx == 0 {
-			s.callHandlers(InfoLevel, s, ie, fmt.Sprint(args...))
+			s.callHandlers(InfoLevel, s, ie, fmt.Sprint(args...), nil)
 			return
 		}
-		s.callHandlers(InfoLevel, s, ie, fmt.Sprint(args[firstIdx:]...))
+		s.callHandlers(InfoLevel, s, ie, fmt.Sprint(args[firstIdx:]...), nil)
 	}
 }
 
@@ -255,7 +323,15 @@ func (s *Scope) Infof(args ...any) {
 		if len(args) > 1 {
 			msg = fmt.Sprintf(msg, args[firstIdx+1:]...)
 		}
-		s.callHandlers(InfoLevel, s, ie, msg)
+		s.callHandlers(InfoLevel, s, ie, msg, nil)
+	}
+}
+
+// Infow outputs a message at info level, with fields given either as Field values or as alternating keys and
+// values.
+func (s *Scope) Infow(msg string, kvlist ...any) {
+	if s.GetOutputLevel() >= InfoLevel {
+		s.callHandlers(InfoLevel, s, nil, msg, toFields(kvlist))
 	}
 }
 
@@ -269,10 +345,10 @@ func (s *Scope) Debug(args ...any) {
 	if s.GetOutputLevel() >= DebugLevel {
 		ie, firstIdx := getErrorStruct(args)
 		if firstIdx == 0 {
-			s.callHandlers(DebugLevel, s, ie, fmt.Sprint(args...))
+			s.callHandlers(DebugLevel, s, ie, fmt.Sprint(args...), nil)
 			return
 		}
-		s.callHandlers(DebugLevel, s, ie, fmt.Sprint(args[firstIdx:]...))
+		s.callHandlers(DebugLevel, s, ie, fmt.Sprint(args[firstIdx:]...), nil)
 	}
 }
 
@@ -284,7 +360,15 @@ func (s *Scope) Debugf(args ...any) {
 		if len(args) > 1 {
 			msg = fmt.Sprintf(msg, args[firstIdx+1:]...)
 		}
-		s.callHandlers(DebugLevel, s, ie, msg)
+		s.callHandlers(DebugLevel, s, ie, msg, nil)
+	}
+}
+
+// Debugw outputs a message at debug level, with fields given either as Field values or as alternating keys and
+// values.
+func (s *Scope) Debugw(msg string, kvlist ...any) {
+	if s.GetOutputLevel() >= DebugLevel {
+		s.callHandlers(DebugLevel, s, nil, msg, toFields(kvlist))
 	}
 }
 
@@ -340,6 +424,38 @@ func (s *Scope) copy() *Scope {
 	return &out
 }
 
+// withSource returns a copy of s emitting the caller at pc, if not 0, and time t, if not zero, rather than those of the
+// call to the handlers.
+func withSource(s *Scope, pc uintptr, t time.Time) *Scope {
+	out := *s
+	out.source = &recordSource{pc: pc, time: t}
+	return &out
+}
+
+// caller returns the caller of a message, skip being the number of frames above the caller of caller, unless s has a
+// source.
+func (s *Scope) caller(skip int) zapcore.EntryCaller {
+	if s.source == nil {
+		return zapcore.NewEntryCaller(runtime.Caller(skip + 1))
+	}
+	if s.source.pc == 0 {
+		return zapcore.EntryCaller{}
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{s.source.pc}).Next()
+	caller := zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, frame.PC != 0)
+	caller.Function = frame.Function
+	return caller
+}
+
+// now returns the time of a message, which is that of the source of s, if any.
+func (s *Scope) now() time.Time {
+	if s.source != nil && !s.source.time.IsZero() {
+		return s.source.time
+	}
+	return time.Now()
+}
+
 // WithLabels adds a key-value pairs to the labels in s. The key must be a string, while the value may be any type.
 // It returns a copy of s, with the labels added.
 // e.g. newScope := oldScope.WithLabels("foo", "bar", "baz", 123, "qux", 0.123)
@@ -369,11 +485,37 @@ func (s *Scope) callHandlers(
 	scope *Scope,
 	ie *structured.Error,
 	msg string,
+	fields []Field,
 ) {
+	if sp := s.getSampler(); sp != nil && !sp.allow(s, severity, msg) {
+		return
+	}
+	if d := dedup.Load(); d != nil && !d.allow(s, severity, ie, msg, fields) {
+		return
+	}
+
+	// not calling dispatch, which would change the depth of the caller
 	defaultHandlersMu.RLock()
-	defer defaultHandlersMu.RUnlock()
-	for _, h := range defaultHandlers {
-		h(severity, scope, ie, msg)
+	handlers := defaultHandlers
+	defaultHandlersMu.RUnlock()
+	for _, h := range handlers {
+		h.handle(severity, scope, ie, msg, fields)
+	}
+}
+
+// dispatch calls all handlers registered to s, bypassing sampling.
+func (s *Scope) dispatch(
+	severity Level,
+	scope *Scope,
+	ie *structured.Error,
+	msg string,
+	fields []Field,
+) {
+	defaultHandlersMu.RLock()
+	handlers := defaultHandlers
+	defaultHandlersMu.RUnlock()
+	for _, h := range handlers {
+		h.handle(severity, scope, ie, msg, fields)
 	}
 }
 
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func runTest(t *testing.T, f func()) []string {
@@ -50,7 +51,7 @@ func TestKlog(t *testing.T) {
 		},
 		{
 			func() { klog.ErrorS(errors.New("my error"), "info") },
-			"error\tklog\tmy error: info",
+			"error\tklog\tinfo\terror=my error",
 		},
 		{
 			func() { klog.Info("a", "b") },
@@ -62,7 +63,7 @@ func TestKlog(t *testing.T) {
 		},
 		{
 			func() { klog.ErrorS(errors.New("my error"), "info", "key", 1) },
-			"error\tklog\tmy error: info\tkey=1",
+			"error\tklog\tinfo\tkey=1 error=my error",
 		},
 	}
 	for _, tt := range cases {
@@ -321,6 +322,48 @@ func TestScopeJSON(t *testing.T) {
 	mustRegexMatchString(t, lines[0], `{.*"msg":"Hello","foo":"bar","baz":123}`)
 }
 
+func TestScopeFields(t *testing.T) {
+	const name = "TestScope"
+	const desc = "Desc"
+	s := RegisterScope(name, desc, 0)
+	s.SetOutputLevel(DebugLevel)
+
+	lines := runTest(t, func() {
+		s.WithLabels("foo", "bar").Debugw("Hello", String("path", "/foo"), Duration("elapsed", 1500*time.Millisecond), "status", 200)
+		s.Infow("Hello", Err(errors.New("boom")), Int("count", 3))
+		s.Warnw("Hello", "dangling")
+		s.Errorw("Hello", 42, "value")
+		Infow("Hello", "foo", "bar")
+	})
+
+	mustRegexMatchString(t, lines[0], `Hello	foo=bar path=/foo elapsed=1.5s status=200$`)
+	mustRegexMatchString(t, lines[1], `Hello	error=boom count=3$`)
+	mustRegexMatchString(t, lines[2], `Hello	fields error=missing value for field dangling$`)
+	mustRegexMatchString(t, lines[3], `Hello	fields error=field name 42 must be a string, got int$`)
+	mustRegexMatchString(t, lines[4], `Hello	foo=bar$`)
+}
+
+func TestScopeFieldsJSON(t *testing.T) {
+	const name = "TestScope"
+	const desc = "Desc"
+	s := RegisterScope(name, desc, 0)
+	s.SetOutputLevel(DebugLevel)
+
+	lines, err := captureStdout(func() {
+		o := DefaultOptions()
+		o.JSONEncoding = true
+		Configure(o)
+		s.WithLabels("foo", "bar").Infow("Hello", Int("count", 3), Duration("elapsed", time.Second), Err(errors.New("boom")), "status", 200)
+
+		_ = Sync()
+	})
+	if err != nil {
+		t.Errorf("Got error '%v', expected success", err)
+	}
+
+	mustRegexMatchString(t, lines[0], `{.*"msg":"Hello","foo":"bar","count":3,"elapsed":"1s","error":"boom","status":200}`)
+}
+
 func TestScopeErrorDictionary(t *testing.T) {
 	const name = "TestScope"
 	const desc = "Desc"
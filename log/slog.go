@@ -0,0 +1,186 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// slogHandler is a slog.Handler writing to a Scope.
+//
+// The attributes of the records are emitted as fields, and groups as nested objects. The labels and span of the
+// context the records are logged with are emitted as well.
+type slogHandler struct {
+	scope *Scope
+
+	// attributes added by WithAttrs and groups opened by WithGroup, in order
+	goas []groupOrAttrs
+}
+
+// groupOrAttrs is either a group name or a list of attributes.
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+var _ slog.Handler = &slogHandler{}
+
+// NewSlogHandler returns a slog.Handler writing to the given scope. Its records are filtered by the output level of
+// the scope, slog.LevelDebug and below mapping to DebugLevel, and greater levels to the closest level not above them.
+func NewSlogHandler(s *Scope) slog.Handler {
+	return &slogHandler{scope: s}
+}
+
+// Slog returns a slog.Logger writing to s.
+func (s *Scope) Slog() *slog.Logger {
+	return slog.New(NewSlogHandler(s))
+}
+
+// fromSlogLevel maps a slog level to a Level.
+func fromSlogLevel(l slog.Level) Level {
+	switch {
+	case l >= slog.LevelError:
+		return ErrorLevel
+	case l >= slog.LevelWarn:
+		return WarnLevel
+	case l >= slog.LevelInfo:
+		return InfoLevel
+	default:
+		return DebugLevel
+	}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return h.scope.GetOutputLevel() >= fromSlogLevel(l)
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	// the caller and time are those of the record, so that wrappers of slog.Logger can set them
+	fields := append(contextFields(ctx), slogFields(h.goas, attrs)...)
+	h.scope.callHandlers(fromSlogLevel(r.Level), withSource(h.scope, r.PC, r.Time), nil, r.Message, fields)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(groupOrAttrs{attrs: attrs})
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(groupOrAttrs{group: name})
+}
+
+func (h *slogHandler) with(goa groupOrAttrs) *slogHandler {
+	out := *h
+	out.goas = make([]groupOrAttrs, 0, len(h.goas)+1)
+	out.goas = append(out.goas, h.goas...)
+	out.goas = append(out.goas, goa)
+	return &out
+}
+
+// slogFields returns the fields for the attributes of a record, nested in the groups of goas. Empty groups are
+// omitted, as slog handlers do.
+func slogFields(goas []groupOrAttrs, attrs []slog.Attr) []Field {
+	if len(goas) == 0 {
+		return attrFields(attrs)
+	}
+
+	goa := goas[0]
+	if goa.group == "" {
+		return append(attrFields(goa.attrs), slogFields(goas[1:], attrs)...)
+	}
+
+	inner := slogFields(goas[1:], attrs)
+	if len(inner) == 0 {
+		return nil
+	}
+	return []Field{zap.Object(goa.group, fieldList(inner))}
+}
+
+func attrFields(attrs []slog.Attr) []Field {
+	fields := make([]Field, 0, len(attrs))
+	for _, a := range attrs {
+		if f, ok := attrField(a); ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// attrField returns the field for a, or false if a is to be ignored.
+func attrField(a slog.Attr) (Field, bool) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return Field{}, false
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return zap.String(a.Key, a.Value.String()), true
+	case slog.KindInt64:
+		return zap.Int64(a.Key, a.Value.Int64()), true
+	case slog.KindUint64:
+		return zap.Uint64(a.Key, a.Value.Uint64()), true
+	case slog.KindFloat64:
+		return zap.Float64(a.Key, a.Value.Float64()), true
+	case slog.KindBool:
+		return zap.Bool(a.Key, a.Value.Bool()), true
+	case slog.KindDuration:
+		return zap.Duration(a.Key, a.Value.Duration()), true
+	case slog.KindTime:
+		return zap.Time(a.Key, a.Value.Time()), true
+	case slog.KindGroup:
+		fields := attrFields(a.Value.Group())
+		if len(fields) == 0 {
+			return Field{}, false
+		}
+		if a.Key == "" {
+			return zap.Inline(fieldList(fields)), true
+		}
+		return zap.Object(a.Key, fieldList(fields)), true
+	default:
+		if err, ok := a.Value.Any().(error); ok {
+			return zap.NamedError(a.Key, err), true
+		}
+		return zap.Any(a.Key, a.Value.Any()), true
+	}
+}
+
+// fieldList encodes fields as an object.
+type fieldList []Field
+
+func (fl fieldList) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range fl {
+		f.AddTo(enc)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSlog(t *testing.T) {
+	s := RegisterScope("slogscope", "", 0)
+
+	cases := []struct {
+		name     string
+		level    Level
+		log      func(l *slog.Logger)
+		expected []string
+	}{
+		{
+			name:  "levels",
+			level: InfoLevel,
+			log: func(l *slog.Logger) {
+				l.Debug("debug")
+				l.Info("info")
+				l.Warn("warn")
+				l.Error("error")
+				l.Log(context.Background(), slog.LevelError+4, "critical")
+			},
+			expected: []string{
+				`"level":"info".*"msg":"info"`,
+				`"level":"warn".*"msg":"warn"`,
+				`"level":"error".*"msg":"error"`,
+				`"level":"error".*"msg":"critical"`,
+			},
+		},
+		{
+			name:  "debug level",
+			level: DebugLevel,
+			log: func(l *slog.Logger) {
+				l.Log(context.Background(), slog.LevelDebug-4, "trace")
+			},
+			expected: []string{`"level":"debug".*"msg":"trace"`},
+		},
+		{
+			name:  "attributes",
+			level: InfoLevel,
+			log: func(l *slog.Logger) {
+				l.With("foo", "bar").Info("msg", "count", 3, slog.Bool("ok", true), "err", errors.New("boom"))
+			},
+			expected: []string{`"msg":"msg","foo":"bar","count":3,"ok":true,"err":"boom"}`},
+		},
+		{
+			name:  "groups",
+			level: InfoLevel,
+			log: func(l *slog.Logger) {
+				l.With("foo", "bar").WithGroup("req").With("id", 1).Info("msg", slog.Group("user", "name", "x"), slog.Group("", "inline", 2))
+				l.WithGroup("empty").Info("msg")
+			},
+			expected: []string{
+				`"msg":"msg","foo":"bar","req":{"id":1,"user":{"name":"x"},"inline":2}}`,
+				`"msg":"msg"}`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lines, err := captureStdout(func() {
+				o := DefaultOptions()
+				o.JSONEncoding = true
+				Configure(o)
+				s.SetOutputLevel(c.level)
+				c.log(s.Slog())
+				_ = Sync()
+			})
+			if err != nil {
+				t.Fatalf("Got error '%v', expected success", err)
+			}
+			if lines[len(lines)-1] == "" {
+				lines = lines[:len(lines)-1]
+			}
+
+			mustMatchLength(t, len(c.expected), lines)
+			for i, e := range c.expected {
+				mustRegexMatchString(t, lines[i], e)
+				mustRegexMatchString(t, lines[i], `"scope":"slogscope"`)
+			}
+		})
+	}
+}
+
+func TestSlogCaller(t *testing.T) {
+	s := newScope()
+	s.SetLogCallers(true)
+
+	lines := runTest(t, func() {
+		s.Slog().Info("msg", "key", 1)
+		s.Slog().WithGroup("g").Warn("msg")
+	})
+	mustMatchLength(t, 2, lines)
+	mustRegexMatchString(t, lines[0], "info\tlog/slog_test.go:[0-9]+\tmsg\tkey=1")
+	mustRegexMatchString(t, lines[1], "warn\tlog/slog_test.go:[0-9]+\tmsg")
+}
+
+// logWrapped logs msg through h, as a wrapper of slog.Logger does, with the caller of logWrapped.
+func logWrapped(h slog.Handler, ts time.Time, msg string) {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	_ = h.Handle(context.Background(), slog.NewRecord(ts, slog.LevelInfo, msg, pcs[0]))
+}
+
+func TestSlogRecordSource(t *testing.T) {
+	s := newScope()
+	s.SetLogCallers(true)
+
+	var entries []Entry
+	defer RegisterHandler("TestSlogRecordSource", func(e Entry) { entries = append(entries, e) })()
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	lines := runTest(t, func() {
+		logWrapped(NewSlogHandler(s), ts, "wrapped")
+		_ = NewSlogHandler(s).Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "no source", 0))
+	})
+	mustMatchLength(t, 2, lines)
+	mustRegexMatchString(t, lines[0], `^2020-01-02T03:04:05\.000000Z\tinfo\tlog/slog_test.go:[0-9]+\twrapped$`)
+	mustRegexMatchString(t, lines[1], `^\S+\tinfo\tno source$`)
+	if !entries[0].Time.Equal(ts) || entries[1].Time.IsZero() {
+		t.Errorf("Got times %v and %v, expected the time of the record, or the current time", entries[0].Time, entries[1].Time)
+	}
+}
+
+func TestSlogEnabled(t *testing.T) {
+	s := newScope()
+	s.SetOutputLevel(WarnLevel)
+	h := NewSlogHandler(s)
+
+	if h.Enabled(context.Background(), slog.LevelInfo) {
+		t.Fatal("expected info to be disabled")
+	}
+	if !h.Enabled(context.Background(), slog.LevelWarn+1) {
+		t.Fatal("expected warn+1 to be enabled")
+	}
+}
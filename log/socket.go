@@ -0,0 +1,213 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	socketTimeout             = time.Second
+	defaultSocketRetryBackoff = 100 * time.Millisecond
+	maxSocketRetryBackoff     = 5 * time.Second
+)
+
+// socketSink writes the queued entries to a persistent connection. The entries are written in the background as soon
+// as they are queued, and on Sync and Close. While the connection is down, they stay queued, and it is reestablished
+// with an exponential backoff.
+//
+// Over stream connections, the entries are framed by frame, if set, and written in batches. Over datagram ones, each
+// entry is written as a datagram.
+type socketSink struct {
+	// name and address identify the log server in the error messages
+	name    string
+	address string
+	dial    func() (net.Conn, error)
+	frame   func(msg string) string
+	errSink io.Writer
+
+	queue *entryQueue
+
+	// serializes the writes, and guards conn
+	sendMu sync.Mutex
+	conn   net.Conn
+
+	notifyCh  chan struct{}
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	doneCh    chan struct{}
+}
+
+// newSocketSink returns a sink writing the entries as newline-delimited JSON to a unix or TCP connection, as expected
+// by the forward inputs of log collectors.
+func newSocketSink(options *Options, errSink io.Writer) *socketSink {
+	s := &socketSink{
+		name:    "log socket",
+		address: options.socketAddress,
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout(options.socketNetwork, options.socketAddress, socketTimeout)
+		},
+		errSink: errSink,
+		queue:   newEntryQueue(options.socketQueueSize, options.socketDropPolicy),
+	}
+	s.start()
+	return s
+}
+
+// start starts the background writing.
+func (s *socketSink) start() {
+	s.notifyCh = make(chan struct{}, 1)
+	s.closeCh = make(chan struct{})
+	s.doneCh = make(chan struct{})
+	go s.run()
+}
+
+// enqueue queues msg, and wakes up the background writing.
+func (s *socketSink) enqueue(msg string) {
+	s.queue.push(msg)
+	select {
+	case s.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *socketSink) run() {
+	defer close(s.doneCh)
+
+	backoff := defaultSocketRetryBackoff
+	failing := false
+	var retry <-chan time.Time
+
+	for {
+		// new entries don't cut a backoff short
+		notify := s.notifyCh
+		if retry != nil {
+			notify = nil
+		}
+
+		select {
+		case <-notify:
+		case <-retry:
+		case <-s.closeCh:
+			return
+		}
+
+		retry = nil
+		if err := s.flush(); err != nil {
+			// reported once per disconnection
+			if !failing {
+				_, _ = fmt.Fprintf(s.errSink, "%v log write error: %v\n", time.Now(), err)
+				failing = true
+			}
+			retry = time.After(backoff)
+			backoff *= 2
+			if backoff > maxSocketRetryBackoff {
+				backoff = maxSocketRetryBackoff
+			}
+			continue
+		}
+
+		failing = false
+		backoff = defaultSocketRetryBackoff
+	}
+}
+
+// flush writes the queued entries, connecting first if needed. The entries not written are queued again.
+func (s *socketSink) flush() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	batch, dropped := s.queue.take(0)
+	if dropped > 0 {
+		_, _ = fmt.Fprintf(s.errSink, "%v %s queue full, dropped %d entries\n", time.Now(), s.name, dropped)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			s.queue.requeue(batch)
+			return fmt.Errorf("failed to connect to %s %v: %v", s.name, s.address, err)
+		}
+		s.conn = conn
+	}
+
+	if !isStream(s.conn) {
+		for i, msg := range batch {
+			_ = s.conn.SetWriteDeadline(time.Now().Add(socketTimeout))
+			if _, err := s.conn.Write([]byte(msg)); err != nil {
+				s.disconnect()
+				s.queue.requeue(batch[i:])
+				return fmt.Errorf("failed to write logs to %s %v: %v", s.name, s.address, err)
+			}
+		}
+		return nil
+	}
+
+	framed := batch
+	if s.frame != nil {
+		framed = make([]string, len(batch))
+		for i, msg := range batch {
+			framed[i] = s.frame(msg)
+		}
+	}
+
+	_ = s.conn.SetWriteDeadline(time.Now().Add(socketTimeout))
+	n, err := s.conn.Write([]byte(strings.Join(framed, "")))
+	if err != nil {
+		s.disconnect()
+		s.queue.requeue(batch[len(batch)-len(unwritten(framed, n)):])
+		return fmt.Errorf("failed to write logs to %s %v: %v", s.name, s.address, err)
+	}
+	return nil
+}
+
+// disconnect closes the connection, so that it is reestablished on the next write. sendMu must be held.
+func (s *socketSink) disconnect() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// isStream returns whether conn is a stream connection, rather than a datagram one.
+func isStream(conn net.Conn) bool {
+	switch conn.(type) {
+	case *net.UDPConn, *net.IPConn:
+		return false
+	case *net.UnixConn:
+		return conn.RemoteAddr().Network() != "unixgram"
+	default:
+		return true
+	}
+}
+
+// unwritten returns the entries of batch which weren't fully written, n bytes of it having been written.
+func unwritten(batch []string, n int) []string {
+	for i, msg := range batch {
+		if n < len(msg) {
+			return batch[i:]
+		}
+		n -= len(msg)
+	}
+	return nil
+}
+
+// close stops the background writing, writes the queued entries a last time, and closes the connection.
+func (s *socketSink) close() error {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+	})
+	<-s.doneCh
+	err := s.flush()
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.disconnect()
+	return err
+}
@@ -0,0 +1,149 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serveSocket accepts connections on l, and sends the lines received to the returned channel.
+func serveSocket(t *testing.T, l net.Listener) <-chan string {
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+	return lines
+}
+
+func receiveMessage(t *testing.T, lines <-chan string) map[string]any {
+	t.Helper()
+	select {
+	case line := <-lines:
+		m := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("received invalid JSON %q: %v", line, err)
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a log message")
+		return nil
+	}
+}
+
+func TestSocketLog(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	lines := serveSocket(t, l)
+
+	o := DefaultOptions()
+	o.JSONEncoding = true
+	if err := Configure(o.WithTeeToSocket("unix", socketPath)); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	WithLabels("k", "v").Info("test")
+	Warn("test2")
+
+	got := []map[string]any{receiveMessage(t, lines), receiveMessage(t, lines)}
+	for _, m := range got {
+		delete(m, "time")
+	}
+	want := []map[string]any{
+		{"level": "info", "msg": "test", "k": "v"},
+		{"level": "warn", "msg": "test2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("received log messages, got %v want %v", got, want)
+	}
+}
+
+func TestSocketLogReconnect(t *testing.T) {
+	// reserve an address, and free it so that the sink can't connect at first
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	if err := Configure(DefaultOptions().WithTeeToSocket("tcp", addr)); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	Info("test")
+	time.Sleep(50 * time.Millisecond)
+	Info("test2")
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	lines := serveSocket(t, l)
+
+	for _, want := range []string{"test", "test2"} {
+		if got := receiveMessage(t, lines)["msg"]; got != want {
+			t.Errorf("received log message %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSocketLogClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	lines := serveSocket(t, l)
+
+	if err := Configure(DefaultOptions().WithTeeToSocket("tcp", l.Addr().String())); err != nil {
+		t.Fatal(err)
+	}
+	Info("test")
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := receiveMessage(t, lines)["msg"]; got != "test" {
+		t.Errorf("received log message %v, want test", got)
+	}
+}
+
+func TestUnwritten(t *testing.T) {
+	batch := []string{"a\n", "bc\n", "d\n"}
+	cases := []struct {
+		n    int
+		want []string
+	}{
+		{0, batch},
+		{2, batch[1:]},
+		{3, batch[1:]},
+		{5, batch[2:]},
+		{7, nil},
+	}
+	for _, c := range cases {
+		if got := unwritten(batch, c.n); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("unwritten(%d) = %v, want %v", c.n, got, c.want)
+		}
+	}
+}
@@ -27,6 +27,7 @@ func encodeStackdriverLevel(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder)
 
 type stackdriverCore struct {
 	logger       *logging.Logger
+	project      string
 	minimumLevel zapcore.Level
 	fields       map[string]any
 }
@@ -49,7 +50,7 @@ func teeToStackdriver(baseCore zapcore.Core, project, quotaProject, logName stri
 	} else {
 		logger = client.Logger(logName)
 	}
-	sdCore := &stackdriverCore{logger: logger}
+	sdCore := &stackdriverCore{logger: logger, project: project}
 
 	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
 		if baseCore.Enabled(l) {
@@ -68,6 +69,7 @@ func (sc *stackdriverCore) Enabled(l zapcore.Level) bool {
 func (sc *stackdriverCore) With(fields []zapcore.Field) zapcore.Core {
 	return &stackdriverCore{
 		logger:       sc.logger,
+		project:      sc.project,
 		minimumLevel: sc.minimumLevel,
 		fields:       clone(sc.fields, fields),
 	}
@@ -93,18 +95,30 @@ func (sc *stackdriverCore) Write(entry zapcore.Entry, fields []zapcore.Field) er
 		severity = logging.Default
 	}
 
+	tc, fields := traceContextOf(fields)
 	payload := clone(sc.fields, fields)
 
 	payload["logger"] = entry.LoggerName
 	payload["message"] = entry.Message
 
-	sc.logger.Log(logging.Entry{
+	sc.logger.Log(sc.newEntry(entry, severity, payload, tc))
+
+	return nil
+}
+
+// newEntry returns the Stackdriver entry for a log entry, correlated with the trace context if any.
+func (sc *stackdriverCore) newEntry(entry zapcore.Entry, severity logging.Severity, payload map[string]any, tc *traceContext) logging.Entry {
+	e := logging.Entry{
 		Timestamp: entry.Time,
 		Severity:  severity,
 		Payload:   payload,
-	})
-
-	return nil
+	}
+	if tc != nil {
+		e.Trace = tc.traceName(sc.project)
+		e.SpanID = tc.SpanID.String()
+		e.TraceSampled = tc.IsSampled()
+	}
+	return e
 }
 
 func clone(orig map[string]any, newFields []zapcore.Field) map[string]any {
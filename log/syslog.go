@@ -0,0 +1,286 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"khetao.com/pkg/structured"
+)
+
+const (
+	// syslogHandlerName is the name of the scope handler writing to syslog.
+	syslogHandlerName = "syslog"
+
+	// syslogEnterpriseID qualifies the names of the structured data elements, as required by RFC 5424. 32473 is the
+	// enterprise number reserved for documentation by RFC 5612.
+	syslogEnterpriseID = "32473"
+
+	defaultSyslogFacility = "user"
+	syslogTimeout         = time.Second
+)
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// levelToSyslogSeverity maps the levels to the severities of RFC 5424.
+var levelToSyslogSeverity = map[Level]int{
+	FatalLevel: 2, // critical
+	ErrorLevel: 3, // error
+	WarnLevel:  4, // warning
+	InfoLevel:  6, // informational
+	DebugLevel: 7, // debug
+}
+
+// syslogWriter writes messages to a syslog server, formatted as per RFC 5424. The scope of a message is carried in
+// the log structured data element, its labels and fields in the labels element, and its structured error in the
+// error element.
+//
+// Messages are sent as datagrams over UDP and unix datagram sockets, and with octet-counting framing over TCP and unix
+// stream sockets, as per RFC 6587.
+// They are queued, and written in the background, but for fatal ones which are written right away, before the process
+// exits. While the connection is down, they stay queued, and it is reestablished with an exponential backoff.
+type syslogWriter struct {
+	facility int
+	appName  string
+	hostname string
+	pid      string
+
+	sink *socketSink
+}
+
+// parseSyslogTarget parses a syslog target, in the form of unix:///dev/log, udp://host:port or tcp://host:port.
+func parseSyslogTarget(target string) (string, string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog target %q: %v", target, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		return "unix", u.Path, nil
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid syslog target %q: missing address", target)
+		}
+		return u.Scheme, u.Host, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog target %q: the scheme must be unix, udp or tcp", target)
+	}
+}
+
+func newSyslogWriter(options *Options, errSink io.Writer) (*syslogWriter, error) {
+	network, address, err := parseSyslogTarget(options.syslogTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	facilityName := options.syslogFacility
+	if facilityName == "" {
+		facilityName = defaultSyslogFacility
+	}
+	facility, ok := syslogFacilities[facilityName]
+	if !ok {
+		return nil, fmt.Errorf("invalid syslog facility %q", facilityName)
+	}
+
+	appName := options.syslogAppName
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+
+	hostname, _ := os.Hostname()
+
+	w := &syslogWriter{
+		facility: facility,
+		appName:  syslogHeaderField(appName, 48),
+		hostname: syslogHeaderField(hostname, 255),
+		pid:      strconv.Itoa(os.Getpid()),
+		sink: &socketSink{
+			name:    "syslog",
+			address: address,
+			dial: func() (net.Conn, error) {
+				return dialSyslog(network, address)
+			},
+			frame:   frameSyslog,
+			errSink: errSink,
+			queue:   newEntryQueue(0, DropOldest),
+		},
+	}
+	w.sink.start()
+	return w, nil
+}
+
+// handle is the scope handler writing to syslog.
+func (w *syslogWriter) handle(level Level, scope *Scope, ie *structured.Error, msg string, fields []Field) {
+	w.sink.enqueue(w.format(newEntry(level, scope, ie, msg, fields)))
+	if level == FatalLevel {
+		reportWriteError(w.sink.flush())
+	}
+}
+
+// writeEntry writes the entries logged through zap.
+func (w *syslogWriter) writeEntry(e Entry, _ zapcore.EntryCaller) error {
+	w.sink.enqueue(w.format(e))
+	if e.Level == FatalLevel {
+		return w.sink.flush()
+	}
+	return nil
+}
+
+// dialSyslog connects to the syslog server. The unix sockets of syslog servers are usually datagram sockets, but
+// stream ones are supported as well.
+func dialSyslog(network, address string) (net.Conn, error) {
+	if network != "unix" {
+		return net.DialTimeout(network, address, syslogTimeout)
+	}
+	conn, err := net.DialTimeout("unixgram", address, syslogTimeout)
+	if err != nil {
+		conn, err = net.DialTimeout("unix", address, syslogTimeout)
+	}
+	return conn, err
+}
+
+// frameSyslog frames msg with octet counting, for stream sockets, whether TCP or unix ones.
+func frameSyslog(msg string) string {
+	return strconv.Itoa(len(msg)) + " " + msg
+}
+
+// format formats e as an RFC 5424 message.
+func (w *syslogWriter) format(e Entry) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "<%d>1 %s %s %s %s - ",
+		w.facility*8+levelToSyslogSeverity[e.Level],
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		orNil(w.hostname),
+		orNil(w.appName),
+		w.pid)
+
+	sb.WriteString("[log@" + syslogEnterpriseID)
+	appendSDParam(sb, "scope", e.Scope)
+	sb.WriteString("]")
+
+	if len(e.Labels) > 0 {
+		keys := make([]string, 0, len(e.Labels))
+		for k := range e.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		sb.WriteString("[labels@" + syslogEnterpriseID)
+		for _, k := range keys {
+			appendSDParam(sb, k, fmt.Sprint(e.Labels[k]))
+		}
+		sb.WriteString("]")
+	}
+
+	if ie := e.Error; ie != nil {
+		sb.WriteString("[error@" + syslogEnterpriseID)
+		appendSDParam(sb, "moreInfo", ie.MoreInfo)
+		appendSDParam(sb, "impact", ie.Impact)
+		appendSDParam(sb, "action", ie.Action)
+		appendSDParam(sb, "likelyCause", ie.LikelyCause)
+		appendSDParam(sb, "err", toErrString(ie.Err))
+		sb.WriteString("]")
+	}
+
+	if e.Message != "" {
+		sb.WriteString(" ")
+		sb.WriteString(e.Message)
+	}
+	return sb.String()
+}
+
+// appendSDParam appends a structured data parameter to sb. If value is empty, it does nothing.
+func appendSDParam(sb *strings.Builder, name, value string) {
+	if value == "" {
+		return
+	}
+
+	// names are at most 32 printable ASCII characters, other than '=', ' ', ']' and '"'
+	n := []byte(name)
+	if len(n) > 32 {
+		n = n[:32]
+	}
+	for i, c := range n {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			n[i] = '_'
+		}
+	}
+
+	sb.WriteString(" ")
+	sb.Write(n)
+	sb.WriteString(`="`)
+	sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value))
+	sb.WriteString(`"`)
+}
+
+// syslogHeaderField makes s a valid header field of at most max printable ASCII characters.
+func syslogHeaderField(s string, max int) string {
+	b := []byte(s)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// orNil returns s, or the nil value of the header fields if s is empty.
+func orNil(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// close stops the background writing, writes the queued messages a last time, and closes the connection.
+func (w *syslogWriter) close() error {
+	return w.sink.close()
+}
@@ -0,0 +1,265 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"khetao.com/pkg/structured"
+)
+
+// receiveSyslog reads a datagram from conn.
+func receiveSyslog(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to receive syslog message: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestSyslogUnix(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer conn.Close()
+
+	s := RegisterScope("syslogscope", "", 0)
+	if err := Configure(DefaultOptions().WithSyslog("unix://"+socketPath, "local0", "myapp")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = Configure(DefaultOptions())
+	}()
+
+	s.WithLabels("foo", `a "quoted" ]value`).Infow("hello", "count", 3)
+	mustRegexMatchString(t, receiveSyslog(t, conn),
+		`^<134>1 \S+Z \S+ myapp [0-9]+ - \[log@32473 scope="syslogscope"\]`+
+			`\[labels@32473 count="3" foo="a \\"quoted\\" \\]value"\] hello$`)
+
+	s.Error(&structured.Error{MoreInfo: "see docs", Err: errors.New("boom")}, "failed")
+	mustRegexMatchString(t, receiveSyslog(t, conn),
+		`^<131>1 .* \[log@32473 scope="syslogscope"\]\[error@32473 moreInfo="see docs" err="boom"\] failed$`)
+
+	zap.L().With(zap.String("k", "v")).Warn("captured")
+	mustRegexMatchString(t, receiveSyslog(t, conn),
+		`^<132>1 .* \[log@32473 scope="default"\]\[labels@32473 k="v"\] captured$`)
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer conn.Close()
+
+	if err := Configure(DefaultOptions().WithSyslog("udp://"+conn.LocalAddr().String(), "", "")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = Configure(DefaultOptions())
+	}()
+
+	Warn("hello")
+	mustRegexMatchString(t, receiveSyslog(t, conn), `^<12>1 \S+ \S+ log\.test [0-9]+ - \[log@32473 scope="default"\] hello$`)
+}
+
+// serveSyslogStream accepts a stream connection on l, and sends the octet-counted frames received to the returned
+// channel.
+func serveSyslogStream(t *testing.T, l net.Listener) <-chan string {
+	frames := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// octet counting framing
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			frames <- string(buf)
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+	return frames
+}
+
+// receiveSyslogFrames checks the frames received match want, in order.
+func receiveSyslogFrames(t *testing.T, frames <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case frame := <-frames:
+			mustRegexMatchString(t, frame, w)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a syslog message")
+		}
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	frames := serveSyslogStream(t, l)
+
+	if err := Configure(DefaultOptions().WithSyslog("tcp://"+l.Addr().String(), "daemon", "app")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = Configure(DefaultOptions())
+	}()
+
+	Info("first")
+	Error("second")
+	receiveSyslogFrames(t, frames, `^<30>1 .* first$`, `^<27>1 .* second$`)
+}
+
+func TestSyslogUnixStream(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "log.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	frames := serveSyslogStream(t, l)
+
+	if err := Configure(DefaultOptions().WithSyslog("unix://"+socketPath, "", "")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = Configure(DefaultOptions())
+	}()
+
+	// each message is framed, as over TCP
+	Info("first")
+	Info("second")
+	receiveSyslogFrames(t, frames, `^<14>1 .* first$`, `^<14>1 .* second$`)
+}
+
+func TestSyslogReconnect(t *testing.T) {
+	// reserve an address, and free it so that the writer can't connect at first
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	if err := Configure(DefaultOptions().WithSyslog("tcp://"+addr, "", "")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = Configure(DefaultOptions())
+	}()
+
+	// the server being down doesn't block logging
+	start := time.Now()
+	Info("first")
+	time.Sleep(50 * time.Millisecond)
+	Info("second")
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("logging took %v, expected the messages to be queued", d)
+	}
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	receiveSyslogFrames(t, serveSyslogStream(t, l), ` first$`, ` second$`)
+}
+
+func TestSyslogOptions(t *testing.T) {
+	cases := []struct {
+		target   string
+		facility string
+		err      string
+	}{
+		{"/dev/log", "", "the scheme must be unix, udp or tcp"},
+		{"udp://", "", "missing address"},
+		{"udp://localhost:514", "nope", `invalid syslog facility "nope"`},
+	}
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			err := Configure(DefaultOptions().WithSyslog(c.target, c.facility, ""))
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestAppendSDParam(t *testing.T) {
+	sb := &strings.Builder{}
+	appendSDParam(sb, `a b=c]d"e`+strings.Repeat("x", 40), `\v`)
+	appendSDParam(sb, "empty", "")
+
+	want := ` a_b_c_d_e` + strings.Repeat("x", 23) + `="\\v"`
+	if sb.String() != want {
+		t.Errorf("got %q, want %q", sb.String(), want)
+	}
+	if !regexp.MustCompile(`^ [^ =\]"]{32}=`).MatchString(sb.String()) {
+		t.Errorf("invalid parameter name in %q", sb.String())
+	}
+}
+
+func TestSyslogFailedConfigure(t *testing.T) {
+	dir := t.TempDir()
+	listen := func(name string) net.PacketConn {
+		conn, err := net.ListenPacket("unixgram", filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to create listener: %v", err)
+		}
+		return conn
+	}
+	active := listen("active.sock")
+	defer active.Close()
+	next := listen("next.sock")
+	defer next.Close()
+
+	if err := Configure(DefaultOptions().WithSyslog("unix://"+filepath.Join(dir, "active.sock"), "", "")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = Configure(DefaultOptions())
+	}()
+
+	// journald failing, the active configuration is kept, and the new syslog writer isn't used
+	o := DefaultOptions().
+		WithSyslog("unix://"+filepath.Join(dir, "next.sock"), "", "").
+		WithJournald(filepath.Join(dir, "missing.sock"), "")
+	if err := Configure(o); err == nil {
+		t.Fatal("Configure() should fail when journald is unreachable")
+	}
+
+	Warn("kept")
+	mustRegexMatchString(t, receiveSyslog(t, active), `\] kept$`)
+
+	_ = next.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, _, err := next.ReadFrom(make([]byte, 1024)); err == nil {
+		t.Errorf("got %d bytes from the syslog writer of the failed configuration", n)
+	}
+}
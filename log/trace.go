@@ -0,0 +1,108 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	traceIDKey = "traceID"
+	spanIDKey  = "spanID"
+
+	// See https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+	stackdriverTraceKey        = "logging.googleapis.com/trace"
+	stackdriverSpanIDKey       = "logging.googleapis.com/spanId"
+	stackdriverTraceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// traceContext identifies the span a message is logged in. It is emitted as the traceID and spanID keys, except in
+// Stackdriver format, where the keys recognized by Cloud Logging are used instead.
+type traceContext struct {
+	trace.SpanContext
+}
+
+func (tc traceContext) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString(traceIDKey, tc.TraceID.String())
+	enc.AddString(spanIDKey, tc.SpanID.String())
+	return nil
+}
+
+// traceName returns the trace as a resource name of project, as expected by Cloud Logging, or the bare trace ID if
+// the project isn't known.
+func (tc traceContext) traceName(project string) string {
+	if project == "" {
+		return tc.TraceID.String()
+	}
+	return fmt.Sprintf("projects/%s/traces/%s", project, tc.TraceID.String())
+}
+
+// contextFields returns the fields carried by ctx: the span active in ctx, if any, followed by the labels set with
+// WithContextLabels.
+func contextFields(ctx context.Context) []Field {
+	labels := contextLabels(ctx)
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return labels
+	}
+
+	fields := make([]Field, 0, len(labels)+1)
+	fields = append(fields, zap.Inline(traceContext{span.SpanContext()}))
+	return append(fields, labels...)
+}
+
+// traceContextOf returns the trace context among fields, if any, and the other fields.
+func traceContextOf(fields []Field) (*traceContext, []Field) {
+	for i, f := range fields {
+		if tc, ok := f.Interface.(traceContext); ok && f.Type == zapcore.InlineMarshalerType {
+			rest := make([]Field, 0, len(fields)-1)
+			rest = append(append(rest, fields[:i]...), fields[i+1:]...)
+			return &tc, rest
+		}
+	}
+	return nil, fields
+}
+
+// stackdriverEncoder is an encoder of the Stackdriver format, which emits trace contexts with the keys recognized by
+// Cloud Logging.
+type stackdriverEncoder struct {
+	zapcore.Encoder
+	project string
+}
+
+func newStackdriverEncoder(enc zapcore.Encoder, project string) zapcore.Encoder {
+	return &stackdriverEncoder{Encoder: enc, project: project}
+}
+
+func (e *stackdriverEncoder) Clone() zapcore.Encoder {
+	return &stackdriverEncoder{Encoder: e.Encoder.Clone(), project: e.project}
+}
+
+func (e *stackdriverEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	tc, fields := traceContextOf(fields)
+	if tc != nil {
+		fields = append(fields,
+			zap.String(stackdriverTraceKey, tc.traceName(e.project)),
+			zap.String(stackdriverSpanIDKey, tc.SpanID.String()),
+			zap.Bool(stackdriverTraceSampledKey, tc.IsSampled()))
+	}
+	return e.Encoder.EncodeEntry(entry, fields)
+}
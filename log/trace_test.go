@@ -0,0 +1,91 @@
+package log
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap/zapcore"
+)
+
+func newSpanContext(t *testing.T) (context.Context, trace.SpanContext) {
+	ctx, span := trace.StartSpan(context.Background(), "test", trace.WithSampler(trace.AlwaysSample()))
+	t.Cleanup(span.End)
+	return ctx, span.SpanContext()
+}
+
+func TestTraceCorrelation(t *testing.T) {
+	ctx, sc := newSpanContext(t)
+	traceID, spanID := sc.TraceID.String(), sc.SpanID.String()
+
+	lines := runTest(t, func() {
+		defaultScope.InfoCtx(ctx, "Hello")
+		defaultScope.Info("Hello")
+	})
+	mustRegexMatchString(t, lines[0], `Hello	spanID=`+spanID+` traceID=`+traceID+`$`)
+	mustRegexMatchString(t, lines[1], `Hello$`)
+
+	lines, err := captureStdout(func() {
+		o := DefaultOptions()
+		o.JSONEncoding = true
+		Configure(o)
+		defaultScope.InfoCtx(ctx, "Hello")
+		_ = Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+	mustRegexMatchString(t, lines[0], `"msg":"Hello","traceID":"`+traceID+`","spanID":"`+spanID+`"}`)
+}
+
+func TestTraceCorrelationStackdriverFormat(t *testing.T) {
+	ctx, sc := newSpanContext(t)
+
+	lines, err := captureStdout(func() {
+		Configure(DefaultOptions().WithStackdriverLoggingFormat())
+		defaultScope.WithLabels("foo", "bar").InfoCtx(ctx, "Hello")
+		_ = Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+	mustRegexMatchString(t, lines[0], `"message":"Hello","foo":"bar",`+
+		`"logging.googleapis.com/trace":"`+sc.TraceID.String()+`",`+
+		`"logging.googleapis.com/spanId":"`+sc.SpanID.String()+`",`+
+		`"logging.googleapis.com/trace_sampled":true}`)
+}
+
+func TestTraceCorrelationStackdriverFormatProject(t *testing.T) {
+	ctx, sc := newSpanContext(t)
+
+	lines, err := captureStdout(func() {
+		Configure(DefaultOptions().WithStackdriverLoggingFormat().WithStackdriverTraceProject("my-project"))
+		defaultScope.InfoCtx(ctx, "Hello")
+		_ = Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+	mustRegexMatchString(t, lines[0],
+		`"logging.googleapis.com/trace":"projects/my-project/traces/`+sc.TraceID.String()+`"`)
+}
+
+func TestStackdriverCoreTrace(t *testing.T) {
+	_, sc := newSpanContext(t)
+	core := &stackdriverCore{project: "my-project"}
+
+	tc, fields := traceContextOf(contextFields(WithContextLabels(trace.NewContext(context.Background(), nil), "foo", "bar")))
+	if tc != nil || len(fields) != 1 {
+		t.Fatalf("traceContextOf() got %v, %v, expected no trace context", tc, fields)
+	}
+
+	entry := core.newEntry(zapcore.Entry{Time: time.Now()}, logging.Info, nil, &traceContext{sc})
+	if want := "projects/my-project/traces/" + sc.TraceID.String(); entry.Trace != want {
+		t.Errorf("Trace got %q, expected %q", entry.Trace, want)
+	}
+	if entry.SpanID != sc.SpanID.String() || !entry.TraceSampled {
+		t.Errorf("SpanID got %q, sampled %v, expected %q, true", entry.SpanID, entry.TraceSampled, sc.SpanID.String())
+	}
+}
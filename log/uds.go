@@ -5,100 +5,178 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"go.uber.org/zap/buffer"
-	"go.uber.org/zap/zapcore"
+	"io"
 	"net"
 	"net/http"
 	"sync"
 	"time"
 )
 
-type udsCore struct {
-	client       http.Client
-	minimumLevel zapcore.Level
-	url          string
-	enc          zapcore.Encoder
-	buffers      []*buffer.Buffer
-	mu           sync.Mutex
+const (
+	defaultUDSBatchSize     = 100
+	defaultUDSFlushInterval = time.Second
+	defaultUDSRetries       = 3
+	defaultUDSRetryBackoff  = 100 * time.Millisecond
+	maxUDSRetryBackoff      = 5 * time.Second
+	udsRequestTimeout       = time.Second
+)
+
+// udsSink sends the queued entries to the UDS server as a JSON array of strings. Entries are sent in the background
+// once a batch is full, or every flush interval, and on Sync and Close. Failed requests are retried with an
+// exponential backoff, after which the entries are queued again.
+type udsSink struct {
+	client  http.Client
+	url     string
+	errSink io.Writer
+
+	queue         *entryQueue
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	backoff       time.Duration
+
+	// serializes the requests, so that the entries are sent in order
+	sendMu sync.Mutex
+
+	flushCh   chan struct{}
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	doneCh    chan struct{}
 }
 
-func teeToUDSServer(baseCore zapcore.Core, address, path string) zapcore.Core {
-	c := http.Client{
-		Transport: &http.Transport{
-			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", address)
+func newUDSSink(options *Options, errSink io.Writer) *udsSink {
+	address := options.udsSocketAddress
+	u := &udsSink{
+		client: http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return net.Dial("unix", address)
+				},
 			},
+			Timeout: udsRequestTimeout,
 		},
-		Timeout: 100 * time.Millisecond,
+		url:           "http://unix" + options.udsServerPath,
+		errSink:       errSink,
+		queue:         newEntryQueue(options.udsQueueSize, options.udsDropPolicy),
+		batchSize:     options.udsBatchSize,
+		flushInterval: options.udsFlushInterval,
+		retries:       options.udsRetries,
+		backoff:       options.udsRetryBackoff,
+		flushCh:       make(chan struct{}, 1),
+		closeCh:       make(chan struct{}),
+		doneCh:        make(chan struct{}),
 	}
-	uc := &udsCore{
-		client:  c,
-		url:     "http://unix" + path,
-		enc:     zapcore.NewJSONEncoder(defaultEncoderConfig),
-		buffers: make([]*buffer.Buffer, 0),
+
+	if u.batchSize <= 0 {
+		u.batchSize = defaultUDSBatchSize
 	}
-	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
-		if baseCore.Enabled(l) {
-			uc.minimumLevel = l
-			break
-		}
+	if u.flushInterval <= 0 {
+		u.flushInterval = defaultUDSFlushInterval
+	}
+	if u.retries == 0 {
+		u.retries = defaultUDSRetries
+	} else if u.retries < 0 {
+		u.retries = 0
+	}
+	if u.backoff <= 0 {
+		u.backoff = defaultUDSRetryBackoff
 	}
-	return zapcore.NewTee(baseCore, uc)
-}
 
-func (u *udsCore) Enabled(level zapcore.Level) bool {
-	return level >= u.minimumLevel
+	go u.run()
+	return u
 }
 
-func (u *udsCore) With(fields []zapcore.Field) zapcore.Core {
-	return &udsCore{
-		client:       u.client,
-		minimumLevel: u.minimumLevel,
+// enqueue queues msg, and wakes up the background flushing once a batch is full.
+func (u *udsSink) enqueue(msg string) {
+	if u.queue.push(msg) >= u.batchSize {
+		select {
+		case u.flushCh <- struct{}{}:
+		default:
+		}
 	}
 }
 
-func (u *udsCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
-	if u.Enabled(entry.Level) {
-		return ce.AddCore(entry, u)
+func (u *udsSink) run() {
+	defer close(u.doneCh)
+
+	t := time.NewTicker(u.flushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-u.flushCh:
+		case <-u.closeCh:
+			return
+		}
+
+		if err := u.flush(); err != nil {
+			_, _ = fmt.Fprintf(u.errSink, "%v log write error: %v\n", time.Now(), err)
+		}
 	}
-	return ce
 }
 
-func (u *udsCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
-	buffer, err := u.enc.EncodeEntry(entry, fields)
-	if err != nil {
-		return fmt.Errorf("failed to write log to uds logger: %v", err)
+// flush sends the queued entries, batch by batch. It stops at the first batch failing, which is queued again.
+func (u *udsSink) flush() error {
+	u.sendMu.Lock()
+	defer u.sendMu.Unlock()
+
+	for {
+		batch, dropped := u.queue.take(u.batchSize)
+		if dropped > 0 {
+			_, _ = fmt.Fprintf(u.errSink, "%v uds log queue full, dropped %d entries\n", time.Now(), dropped)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := u.send(batch); err != nil {
+			u.queue.requeue(batch)
+			return err
+		}
 	}
-	u.mu.Lock()
-	u.buffers = append(u.buffers, buffer)
-	u.mu.Unlock()
-	return nil
 }
 
-func (u *udsCore) Sync() error {
-	logs := u.logsFromBuffer()
-	msg, err := json.Marshal(logs)
+// send posts batch to the UDS server, retrying on failure.
+func (u *udsSink) send(batch []string) error {
+	msg, err := json.Marshal(batch)
 	if err != nil {
 		return fmt.Errorf("failed to sync uds log: %v", err)
 	}
+
+	backoff := u.backoff
+	for attempt := 0; ; attempt++ {
+		if err = u.post(msg); err == nil || attempt == u.retries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxUDSRetryBackoff {
+			backoff = maxUDSRetryBackoff
+		}
+	}
+}
+
+func (u *udsSink) post(msg []byte) error {
 	resp, err := u.client.Post(u.url, "application/json", bytes.NewReader(msg))
 	if err != nil {
 		return fmt.Errorf("failed to send logs to uds server %v: %v", u.url, err)
 	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("uds server returns non-ok status %v: %v", u.url, resp.Status)
 	}
 	return nil
 }
 
-func (u *udsCore) logsFromBuffer() []string {
-	u.mu.Lock()
-	defer u.mu.Unlock()
-	logs := make([]string, 0, len(u.buffers))
-	for _, b := range u.buffers {
-		logs = append(logs, b.String())
-		b.Free()
-	}
-	u.buffers = make([]*buffer.Buffer, 0)
-	return logs
+// close stops the background flushing, and sends the queued entries a last time.
+func (u *udsSink) close() error {
+	u.closeOnce.Do(func() {
+		close(u.closeCh)
+	})
+	<-u.doneCh
+	return u.flush()
 }
@@ -7,11 +7,19 @@ import (
 	"net/http"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 type udsServer struct {
+	mu       sync.Mutex
 	messages []string
+	// number of requests to fail before accepting them
+	failures int
 }
 
 func (us *udsServer) handleLog(w http.ResponseWriter, r *http.Request) {
@@ -25,9 +33,39 @@ func (us *udsServer) handleLog(w http.ResponseWriter, r *http.Request) {
 	if err := json.Unmarshal(body, &messages); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.failures > 0 {
+		us.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
 	us.messages = append(us.messages, messages...)
 }
 
+func (us *udsServer) received() []string {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return append([]string(nil), us.messages...)
+}
+
+// startUDSServer serves us on a new unix socket, and returns its path.
+func startUDSServer(t *testing.T, us *udsServer) string {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	unixListener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create uds listener: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", us.handleLog)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		_ = srv.Serve(unixListener)
+	}()
+	t.Cleanup(func() { _ = srv.Close() })
+	return socketPath
+}
+
 func TestUDSLog(t *testing.T) {
 	srv := udsServer{messages: make([]string, 0)}
 	udsDir := t.TempDir()
@@ -85,3 +123,130 @@ func TestUDSLog(t *testing.T) {
 		t.Fatalf("number received log messages got %v want %v", got, want)
 	}
 }
+
+func TestUDSLogWith(t *testing.T) {
+	srv := &udsServer{}
+	o := DefaultOptions()
+	o.JSONEncoding = true
+	if err := Configure(o.WithTeeToUDS(startUDSServer(t, srv), "/")); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	zap.L().With(zap.String("k", "v")).Info("test")
+	_ = Sync()
+
+	got := srv.received()
+	if len(got) != 1 || !strings.Contains(got[0], `"msg":"test","k":"v"`) {
+		t.Fatalf("received log messages %v, want the field added by With", got)
+	}
+}
+
+func TestUDSLogBackgroundFlush(t *testing.T) {
+	cases := []struct {
+		name    string
+		options func(o *Options) *Options
+	}{
+		{"size", func(o *Options) *Options { return o.WithUDSBatching(2, time.Hour) }},
+		{"time", func(o *Options) *Options { return o.WithUDSBatching(100, 10*time.Millisecond) }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := &udsServer{}
+			o := DefaultOptions()
+			o.JSONEncoding = true
+			if err := Configure(c.options(o.WithTeeToUDS(startUDSServer(t, srv), "/"))); err != nil {
+				t.Fatal(err)
+			}
+			defer Close()
+
+			Info("test")
+			Info("test2")
+
+			deadline := time.Now().Add(5 * time.Second)
+			for len(srv.received()) != 2 {
+				if time.Now().After(deadline) {
+					t.Fatalf("received log messages %v, want 2", srv.received())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestUDSLogQueue(t *testing.T) {
+	cases := []struct {
+		policy DropPolicy
+		want   []string
+	}{
+		{DropOldest, []string{"test3", "test4"}},
+		{DropNewest, []string{"test1", "test2"}},
+	}
+	for _, c := range cases {
+		t.Run(c.want[0], func(t *testing.T) {
+			srv := &udsServer{}
+			o := DefaultOptions()
+			o.JSONEncoding = true
+			o.WithTeeToUDS(startUDSServer(t, srv), "/").WithUDSBatching(100, time.Hour).WithUDSQueue(2, c.policy)
+			if err := Configure(o); err != nil {
+				t.Fatal(err)
+			}
+			defer Close()
+
+			for i := 1; i <= 4; i++ {
+				Infof("test%d", i)
+			}
+			_ = Sync()
+
+			got := srv.received()
+			if len(got) != len(c.want) {
+				t.Fatalf("received log messages %v, want %v", got, c.want)
+			}
+			for i, w := range c.want {
+				if !strings.Contains(got[i], `"msg":"`+w+`"`) {
+					t.Errorf("received log message %v, want %v", got[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestUDSLogRetries(t *testing.T) {
+	srv := &udsServer{failures: 2}
+	o := DefaultOptions()
+	o.JSONEncoding = true
+	o.WithTeeToUDS(startUDSServer(t, srv), "/").WithUDSBatching(100, time.Hour).WithUDSRetries(1, time.Millisecond)
+	if err := Configure(o); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	// Sync also fails on the standard output of tests, flush the sink directly
+	Info("test")
+	if err := activeUDSSink.Load().flush(); err == nil {
+		t.Fatal("expected the request to fail after a retry")
+	}
+	if err := activeUDSSink.Load().flush(); err != nil {
+		t.Fatalf("expected the request to be retried, got %v", err)
+	}
+	if got := srv.received(); len(got) != 1 {
+		t.Fatalf("received log messages %v, want the message kept across failures", got)
+	}
+}
+
+func TestUDSLogClose(t *testing.T) {
+	srv := &udsServer{}
+	o := DefaultOptions()
+	o.JSONEncoding = true
+	if err := Configure(o.WithTeeToUDS(startUDSServer(t, srv), "/").WithUDSBatching(100, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	Info("test")
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.received(); len(got) != 1 {
+		t.Fatalf("received log messages %v, want the message flushed on close", got)
+	}
+}
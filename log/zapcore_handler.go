@@ -17,7 +17,6 @@ package log
 import (
 	"fmt"
 	"khetao.com/pkg/structured"
-	"runtime"
 	"strings"
 	"time"
 
@@ -43,7 +42,7 @@ var (
 )
 
 func init() {
-	registerDefaultHandler(ZapLogHandlerCallbackFunc)
+	registerDefaultHandler(zapLogHandler)
 }
 
 // ZapLogHandlerCallbackFunc is the handler function that emulates the previous Istio logging output and adds
@@ -54,6 +53,23 @@ func ZapLogHandlerCallbackFunc(
 	ie *structured.Error,
 	msg string,
 ) {
+	zapLogHandler(level, scope, ie, msg, nil)
+}
+
+// zapLogHandler is ZapLogHandlerCallbackFunc, along with the fields passed to the *w functions.
+func zapLogHandler(
+	level Level,
+	scope *Scope,
+	ie *structured.Error,
+	msg string,
+	extra []Field,
+) {
+	if r := redaction.Load(); r != nil {
+		scope = r.labels(scope)
+		ie = r.error(ie)
+		extra = r.fields(extra)
+	}
+
 	var fields []zapcore.Field
 	if useJSON.Load().(bool) {
 		if ie != nil {
@@ -74,10 +90,11 @@ func ZapLogHandlerCallbackFunc(
 				Interface: v,
 			})
 		}
+		fields = append(fields, extra...)
 	} else {
 		sb := &strings.Builder{}
 		sb.WriteString(msg)
-		if ie != nil || len(scope.labelKeys) > 0 {
+		if ie != nil || len(scope.labelKeys) > 0 || len(extra) > 0 {
 			sb.WriteString("\t")
 		}
 		if ie != nil {
@@ -95,6 +112,7 @@ func ZapLogHandlerCallbackFunc(
 			sb.WriteString(fmt.Sprintf("%s=%v", k, scope.labels[k]))
 			space = true
 		}
+		appendFieldStrings(sb, extra, space)
 		msg = sb.String()
 	}
 	emit(scope, toZapLevel[level], msg, fields)
@@ -136,12 +154,12 @@ func emit(scope *Scope, level zapcore.Level, msg string, fields []zapcore.Field)
 	e := zapcore.Entry{
 		Message:    msg,
 		Level:      level,
-		Time:       time.Now(),
+		Time:       scope.now(),
 		LoggerName: scope.nameToEmit,
 	}
 
 	if scope.GetLogCallers() {
-		e.Caller = zapcore.NewEntryCaller(runtime.Caller(scope.callerSkip + callerSkipOffset))
+		e.Caller = scope.caller(scope.callerSkip + callerSkipOffset)
 	}
 
 	if dumpStack(level, scope) {